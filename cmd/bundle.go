@@ -0,0 +1,455 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+// 离线包中的索引文件
+const _bundleIndexFileName = "bundle.json"
+
+const (
+	BundleExport = "export"
+	BundleImport = "import"
+)
+
+type Bundle struct {
+	//export或import
+	Action string
+	//离线包路径
+	Path string
+	//导出时使用的模块清单文件
+	File string
+	//导入到本地目录feed,为空时安装离线包中的模块
+	To string
+	//导入安装时同时下载与解压的模块数量
+	Parallel int
+	//是否禁止执行upack.json中声明的hooks脚本
+	NoScripts bool
+	//安装进度的输出方式: bar、quiet、json
+	Progress string
+}
+
+// 离线包的索引,记录每个模块包的路径与哈希值
+type bundleIndex struct {
+	Created  time.Time      `json:"created"`
+	Packages []*bundleEntry `json:"packages"`
+}
+
+type bundleEntry struct {
+	Group   string `json:"group,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	//离线包中的路径
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+	//模块清单中指定的安装目录
+	Target string `json:"target,omitempty"`
+}
+
+func (e bundleEntry) PackageName() string {
+	return groupAndName(e.Group, e.Name) + "@" + e.Version
+}
+
+func (*Bundle) Name() string { return "bundle" }
+func (*Bundle) Description() string {
+	return "导出包含一组模块包的离线包,或者从离线包安装模块、导入到本地目录feed."
+}
+
+func (b *Bundle) Help() string  { return pkg.DefaultCommandHelp(b) }
+func (b *Bundle) Usage() string { return pkg.DefaultCommandUsage(b) }
+
+func (*Bundle) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "action",
+			Description: "export: 根据模块清单导出离线包;import: 从离线包安装模块或导入到本地目录feed.",
+			Index:       0,
+			TrySetValue: pkg.TrySetStringValue("action", func(cmd pkg.Command) *string {
+				return &cmd.(*Bundle).Action
+			}),
+		},
+		{
+			Name:        "bundle",
+			Description: "离线包路径.",
+			Index:       1,
+			TrySetValue: pkg.TrySetPathValue("bundle", func(cmd pkg.Command) *string {
+				return &cmd.(*Bundle).Path
+			}),
+		},
+	}
+}
+
+func (*Bundle) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "file",
+			Description: "导出时使用的模块清单文件(json或yaml),模块的版本在导出时解析.",
+			TrySetValue: pkg.TrySetPathValue("file", func(cmd pkg.Command) *string {
+				return &cmd.(*Bundle).File
+			}),
+		},
+		{
+			Name:        "to",
+			Description: "导入到本地目录feed,为空时安装离线包中的模块.",
+			TrySetValue: pkg.TrySetPathValue("to", func(cmd pkg.Command) *string {
+				return &cmd.(*Bundle).To
+			}),
+		},
+		{
+			Name:        "parallel",
+			Description: fmt.Sprintf("导入安装时同时下载与解压的模块数量,默认为%d.", _defaultParallel),
+			TrySetValue: pkg.TrySetIntValue("parallel", func(cmd pkg.Command) *int {
+				return &cmd.(*Bundle).Parallel
+			}),
+		},
+		{
+			Name:        "no-scripts",
+			Description: "导入安装时不执行upack.json中声明的hooks脚本.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("no-scripts", func(cmd pkg.Command) *bool {
+				return &cmd.(*Bundle).NoScripts
+			}),
+		},
+		{
+			Name:        "progress",
+			Description: "导入安装时进度的输出方式: bar(默认)、quiet、json.",
+			TrySetValue: pkg.TrySetStringValue("progress", func(cmd pkg.Command) *string {
+				return &cmd.(*Bundle).Progress
+			}),
+		},
+	}
+}
+
+func (b *Bundle) Run() int {
+	if len(b.Path) <= 0 {
+		fmt.Fprintln(os.Stderr, b.Help())
+		return 2
+	}
+	switch strings.ToLower(b.Action) {
+	case BundleExport:
+		if len(b.File) <= 0 {
+			fmt.Fprintln(os.Stderr, "导出离线包时必须通过--file指定模块清单文件")
+			return 2
+		}
+		err := b.export()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case BundleImport:
+		if _, err := newProgressReporter(b.Progress, false); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return b.runImport()
+	}
+	fmt.Fprintf(os.Stderr, "无效的操作: %s,可以使用export或import\n", b.Action)
+	return 2
+}
+
+// 解析模块清单中每个模块的版本,下载后写入离线包
+func (b *Bundle) export() error {
+	manifest, err := readPluginsManifest(b.File)
+	if err != nil {
+		return err
+	}
+
+	index := &bundleIndex{Created: time.Now().UTC()}
+	f, err := os.CreateTemp(filepath.Dir(b.Path), filepath.Base(b.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	seen := make(map[string]bool)
+	for _, manifestEntry := range manifest.Packages {
+		entry, err := b.exportPackage(w, manifestEntry, seen)
+		if err != nil {
+			return fmt.Errorf("导出%s失败: %v", manifestEntry.PackageName(), err)
+		}
+		if entry != nil {
+			index.Packages = append(index.Packages, entry)
+			fmt.Println(entry.PackageName(), "exported")
+		}
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	indexWriter, err := w.Create(_bundleIndexFileName)
+	if err == nil {
+		_, err = indexWriter.Write(data)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, b.Path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d packages exported to %s\n", len(index.Packages), b.Path)
+	return nil
+}
+
+// 解析版本并下载模块包到离线包中,同一版本只导出一次
+func (b *Bundle) exportPackage(w *zip.Writer, manifestEntry PluginsManifestEntry, seen map[string]bool) (*bundleEntry, error) {
+	info, err := parsePackageNameWithVersion(manifestEntry.PackageName())
+	if err != nil {
+		return nil, err
+	}
+	resolver := &Install{SourceFeedName: manifestEntry.Feed}
+	resolver.setupDefaultProperties()
+	if len(info.group) <= 0 {
+		info.group = resolver._configuration.DefaultGroup
+	}
+	version, err := resolver.resolveVersion(info)
+	if err != nil {
+		return nil, err
+	}
+	entry := &bundleEntry{
+		Group:   info.group,
+		Name:    info.name,
+		Version: version.String(),
+		File:    path.Join("packages", info.group, info.name+"-"+version.String()+".upack"),
+		Target:  manifestEntry.Target,
+	}
+	key := strings.ToLower(entry.PackageName())
+	if seen[key] {
+		return nil, nil
+	}
+	seen[key] = true
+
+	packageFile, done, _, err := pkg.Registry("").GetOrDownloadFromFeeds(resolver._configuration.FeedClients(), info.group, info.name, version, false)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	//模块包本身已经压缩,直接存储
+	writer, err := w.CreateHeader(&zip.FileHeader{Name: entry.File, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	sha1Hash, sha256Hash := sha1.New(), sha256.New()
+	entry.Size, err = io.Copy(io.MultiWriter(writer, sha1Hash, sha256Hash), packageFile)
+	if err != nil {
+		return nil, err
+	}
+	entry.SHA1 = hex.EncodeToString(sha1Hash.Sum(nil))
+	entry.SHA256 = hex.EncodeToString(sha256Hash.Sum(nil))
+	return entry, nil
+}
+
+// 读取离线包的索引,并校验所有模块包的哈希值
+func openBundle(bundlePath string) (*zip.ReadCloser, *bundleIndex, map[string]*zip.File, error) {
+	r, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	files := make(map[string]*zip.File, len(r.File))
+	for _, file := range r.File {
+		files[file.Name] = file
+	}
+
+	index := &bundleIndex{}
+	err = func() error {
+		indexFile, ok := files[_bundleIndexFileName]
+		if !ok {
+			return fmt.Errorf("%s不是有效的离线包: 缺少%s", bundlePath, _bundleIndexFileName)
+		}
+		rc, err := indexFile.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		err = json.NewDecoder(rc).Decode(index)
+		if err != nil {
+			return fmt.Errorf("%s不是有效的离线包: %v", bundlePath, err)
+		}
+
+		for _, entry := range index.Packages {
+			err = verifyBundleEntry(files[entry.File], entry)
+			if err != nil {
+				return fmt.Errorf("离线包中的%s校验失败: %v", entry.PackageName(), err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		_ = r.Close()
+		return nil, nil, nil, err
+	}
+	return r, index, files, nil
+}
+
+func verifyBundleEntry(file *zip.File, entry *bundleEntry) error {
+	if file == nil {
+		return fmt.Errorf("缺少%s", entry.File)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	sha1Hash, sha256Hash := sha1.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(sha1Hash, sha256Hash), rc)
+	if err != nil {
+		return err
+	}
+	if size != entry.Size {
+		return fmt.Errorf("大小不一致: %d,应为%d", size, entry.Size)
+	}
+	if hash := hex.EncodeToString(sha1Hash.Sum(nil)); !strings.EqualFold(hash, entry.SHA1) {
+		return fmt.Errorf("sha1不一致: %s,应为%s", hash, entry.SHA1)
+	}
+	if hash := hex.EncodeToString(sha256Hash.Sum(nil)); len(entry.SHA256) > 0 && !strings.EqualFold(hash, entry.SHA256) {
+		return fmt.Errorf("sha256不一致: %s,应为%s", hash, entry.SHA256)
+	}
+	return nil
+}
+
+// 解压离线包中的模块包到临时目录
+func extractBundleEntry(file *zip.File, tempDirectory string) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	f, err := os.CreateTemp(tempDirectory, "*.upack")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, rc)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return f.Name(), err
+}
+
+func (b *Bundle) runImport() int {
+	r, index, files, err := openBundle(b.Path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer r.Close()
+
+	tempDirectory, err := os.MkdirTemp("", "upack-bundle")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	if len(b.To) > 0 {
+		return b.importToDirectory(index, files, tempDirectory)
+	}
+	return b.install(index, files, tempDirectory)
+}
+
+// 通过Install安装离线包中的每个模块,注册表中记录离线包为模块来源
+func (b *Bundle) install(index *bundleIndex, files map[string]*zip.File, tempDirectory string) int {
+	parallel := b.Parallel
+	if parallel <= 0 {
+		parallel = _defaultParallel
+	}
+	progress, _ := newProgressReporter(b.Progress, parallel > 1)
+	bundlePath, err := filepath.Abs(b.Path)
+	if err != nil {
+		bundlePath = b.Path
+	}
+	origin := "file:///" + strings.TrimPrefix(filepath.ToSlash(bundlePath), "/")
+
+	results := make([]installResult, len(index.Packages))
+	var completed int32
+	parallelForEach(len(index.Packages), parallel, func(i int) {
+		entry := index.Packages[i]
+		startTime := time.Now()
+		installCmd := &Install{
+			TargetDirectory: entry.Target,
+			NoScripts:       b.NoScripts,
+			Progress:        b.Progress,
+			_progress:       progress,
+			_origin:         origin,
+		}
+		packagePath, err := extractBundleEntry(files[entry.File], tempDirectory)
+		if err == nil {
+			installCmd.PackageName = packagePath
+			err = installCmd.install()
+		}
+		results[i] = newInstallResult(installCmd, entry.PackageName(), err)
+
+		n := atomic.AddInt32(&completed, 1)
+		reportResult(progress, pkg.ProgressInstall, results[i].PackageName, fmt.Sprintf("[%d/%d] %s %s, elapsed time:%.0f seconds", n, len(index.Packages), results[i].Status, results[i].PackageName, time.Since(startTime).Seconds()))
+	})
+	return printInstallResults(progress, results)
+}
+
+// 将离线包中的模块包上传到本地目录feed,已存在且sha1相同的版本跳过
+func (b *Bundle) importToDirectory(index *bundleIndex, files map[string]*zip.File, tempDirectory string) int {
+	feed, err := resolveFeedClient(b.To, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ctx := context.Background()
+	var failed int
+	for _, entry := range index.Packages {
+		existing, err := feed.GetVersion(ctx, entry.Group, entry.Name, entry.Version)
+		if err == nil && strings.EqualFold(existing.SHA1, entry.SHA1) {
+			fmt.Println(entry.PackageName(), "skipped, sha1 matches")
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("已存在哈希值不同的版本(sha1: %s)", existing.SHA1)
+		} else if pkg.IsNotFound(err) {
+			var packagePath string
+			packagePath, err = extractBundleEntry(files[entry.File], tempDirectory)
+			if err == nil {
+				err = uploadPackageFile(ctx, feed, packagePath)
+				_ = os.Remove(packagePath)
+			}
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "导入%s失败: %v\n", entry.PackageName(), err)
+			continue
+		}
+		fmt.Println(entry.PackageName(), "imported")
+	}
+	fmt.Printf("%d packages, %d failed\n", len(index.Packages), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
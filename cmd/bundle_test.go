@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+// 以本地目录作为模块仓储导出离线包,返回离线包路径与各模块的sha1
+func exportTestBundle(t *testing.T) (string, map[string]string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	source := t.TempDir()
+	sha1s := map[string]string{
+		"a": writeTestPackage(t, source, "g", "a", "1.0.0", "a"),
+		"b": writeTestPackage(t, source, "g", "b", "2.0.0", "b"),
+	}
+	writeTestPackage(t, source, "g", "b", "1.0.0", "old")
+	t.Setenv(_envKeySourceUrl, source)
+
+	directory := t.TempDir()
+	manifest := filepath.Join(directory, "plugins.json")
+	err := os.WriteFile(manifest, []byte(`{"packages":[{"package":"g/a@1.0.0"},{"package":"g/b","version":"^2"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(directory, "plugins.bundle")
+	if exitCode := (&Bundle{Action: BundleExport, Path: bundlePath, File: manifest}).Run(); exitCode != 0 {
+		t.Fatalf("export exit code = %d", exitCode)
+	}
+	return bundlePath, sha1s
+}
+
+func TestBundleExportImportRoundTrip(t *testing.T) {
+	bundlePath, sha1s := exportTestBundle(t)
+
+	to := t.TempDir()
+	b := &Bundle{Action: BundleImport, Path: bundlePath, To: to}
+	if exitCode := b.Run(); exitCode != 0 {
+		t.Fatalf("import exit code = %d", exitCode)
+	}
+	feed, err := resolveFeedClient(to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, version := range map[string]string{"a": "1.0.0", "b": "2.0.0"} {
+		remote, err := feed.GetVersion(context.Background(), "g", name, version)
+		if err != nil {
+			t.Errorf("%s@%s was not imported: %v", name, version, err)
+			continue
+		}
+		if remote.SHA1 != sha1s[name] {
+			t.Errorf("%s@%s: sha1 = %s, want %s", name, version, remote.SHA1, sha1s[name])
+		}
+	}
+	if _, err = feed.GetVersion(context.Background(), "g", "b", "1.0.0"); !pkg.IsNotFound(err) {
+		t.Errorf("g/b@1.0.0 should not be exported: %v", err)
+	}
+
+	//再次导入时sha1相同的版本跳过
+	if exitCode := b.Run(); exitCode != 0 {
+		t.Fatalf("second import exit code = %d", exitCode)
+	}
+}
+
+func TestBundleImportRejectsModifiedPackage(t *testing.T) {
+	bundlePath, _ := exportTestBundle(t)
+
+	//修改离线包中g/a的一个字节,大小与索引一致但哈希值不同
+	modified := filepath.Join(t.TempDir(), "modified.bundle")
+	rewriteTestBundle(t, bundlePath, modified, "g/a-1.0.0.upack", func(data []byte) []byte {
+		data[len(data)-1] ^= 0xff
+		return data
+	})
+
+	to := t.TempDir()
+	if exitCode := (&Bundle{Action: BundleImport, Path: modified, To: to}).Run(); exitCode == 0 {
+		t.Fatal("import should fail when a package does not match the bundle index")
+	}
+	entries, err := os.ReadDir(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) > 0 {
+		t.Errorf("packages were imported from a modified bundle: %v", entries)
+	}
+}
+
+// 复制离线包,路径以suffix结尾的文件内容由modify修改
+func rewriteTestBundle(t *testing.T, from, to, suffix string, modify func([]byte) []byte) {
+	t.Helper()
+	r, err := zip.OpenReader(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f, err := os.Create(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	var replaced bool
+	for _, file := range r.File {
+		writer, err := w.Create(file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(file.Name, suffix) {
+			replaced = true
+			data = modify(data)
+		}
+		if _, err = writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !replaced {
+		t.Fatalf("%s not found in the bundle", suffix)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -18,6 +18,9 @@ var (
 	// 应用描述
 	AppDescription string
 
+	// 宿主版本,通过WithAppVersion设置,用于检查模块upack.json中requires.host的约束
+	_hostVersion string
+
 	DefaultDispatcher = CommandDispatcher{
 		// &pkg.Pack{},
 		// &pkg.Push{},
@@ -40,6 +43,7 @@ func WithAppTitle(appTitle string) {
 
 func WithAppVersion(version string) {
 	AppVersion = version
+	_hostVersion = version
 }
 
 func WithAppDescription(description string) {
@@ -55,12 +59,29 @@ func (cd CommandDispatcher) Run(args []string) {
 	var positional []string
 	extra := make(map[string]*string)
 
-	for _, arg := range args {
-		if onlyPositional || !strings.HasPrefix(arg, "--") {
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		if onlyPositional || !strings.HasPrefix(arg, "-") || arg == "-" {
 			positional = append(positional, arg)
 		} else if arg == "--" {
 			onlyPositional = true
 			continue
+		} else if !strings.HasPrefix(arg, "--") {
+			//单字母的短参数,如-f plugins.json、-f=plugins.json或-y
+			parts := strings.SplitN(arg[len("-"):], "=", 2)
+			name := strings.ToLower(parts[0])
+			if _, ok := extra[name]; ok {
+				hadError = true
+			}
+
+			if len(parts) == 2 {
+				extra[name] = &parts[1]
+			} else if cd.isFlag(positional, name) || index+1 >= len(args) {
+				extra[name] = nil
+			} else {
+				index++
+				extra[name] = &args[index]
+			}
 		} else {
 			parts := strings.SplitN(arg[len("--"):], "=", 2)
 			if _, ok := extra[strings.ToLower(parts[0])]; ok {
@@ -155,6 +176,30 @@ func (cd CommandDispatcher) Run(args []string) {
 	}
 }
 
+// 判断命令的参数是否为不需要值的开关,positional[0]为命令名称,name为参数名称或别名
+func (cd CommandDispatcher) isFlag(positional []string, name string) bool {
+	if len(positional) == 0 {
+		return true
+	}
+	for _, command := range cd {
+		if !strings.EqualFold(command.Name(), positional[0]) {
+			continue
+		}
+		for _, arg := range command.ExtraArguments() {
+			if strings.EqualFold(arg.Name, name) {
+				return arg.Flag
+			}
+			for _, alias := range arg.Alias {
+				if strings.EqualFold(alias, name) {
+					return arg.Flag
+				}
+			}
+		}
+	}
+	//未知的参数按照开关处理,之后作为多余的参数报错
+	return true
+}
+
 func (cd CommandDispatcher) ShowGenericHelp() {
 	fmt.Fprintln(os.Stderr, AppTitle, AppVersion)
 	fmt.Fprintln(os.Stderr, "Usage: "+AppTitle+" «command»")
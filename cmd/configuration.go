@@ -3,9 +3,14 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shanluzhineng/upack/pkg"
 )
@@ -16,6 +21,32 @@ const (
 	_envKeySourceUrl string = ConfigurationKey + "_sourceUrl"
 	_envKeyFeedName  string = ConfigurationKey + "_feedName"
 	_envKeyApiKey    string = ConfigurationKey + "_apiKey"
+
+	_envKeyAuthType  string = ConfigurationKey + "_authType"
+	_envKeyUsername  string = ConfigurationKey + "_username"
+	_envKeyPassword  string = ConfigurationKey + "_password"
+	_envKeyToken     string = ConfigurationKey + "_token"
+	_envKeyTokenEnv  string = ConfigurationKey + "_tokenEnv"
+	_envKeyTokenFile string = ConfigurationKey + "_tokenFile"
+
+	_envKeyCredentialsFile  string = ConfigurationKey + "_credentialsFile"
+	_envKeyCredentialHelper string = ConfigurationKey + "_credentialHelper"
+
+	_envKeyHostVersion string = ConfigurationKey + "_hostVersion"
+	_envKeyGroup       string = ConfigurationKey + "_group"
+
+	_envKeyConnectTimeout string = ConfigurationKey + "_connectTimeout"
+	_envKeyReadTimeout    string = ConfigurationKey + "_readTimeout"
+	_envKeyProxy          string = ConfigurationKey + "_proxy"
+	_envKeyCAFile         string = ConfigurationKey + "_caFile"
+	_envKeyClientCert     string = ConfigurationKey + "_clientCert"
+	_envKeyClientKey      string = ConfigurationKey + "_clientKey"
+	_envKeyInsecure       string = ConfigurationKey + "_insecure"
+
+	_envKeyFeeds string = ConfigurationKey + "_feeds"
+
+	_envKeyUploadChunkThreshold string = ConfigurationKey + "_uploadChunkThreshold"
+	_envKeyUploadChunkSize      string = ConfigurationKey + "_uploadChunkSize"
 )
 
 func getConfigKey(key string) string {
@@ -23,7 +54,11 @@ func getConfigKey(key string) string {
 }
 
 type Configuration struct {
-	// 模块仓储的授权信息
+	// 模块仓储的认证设置
+	Auth pkg.AuthOptions
+	// 模块仓储的basic认证用户名与密码,不为nil时代替Auth
+	//
+	// Deprecated: 使用Auth.
 	Authentication *[2]string
 	// 模块仓储api url
 	SourceFeedUrl string
@@ -35,6 +70,40 @@ type Configuration struct {
 	SourceUrl string
 	// 获取feed名称
 	SourceFeedName string
+	// 宿主版本,安装时用于检查模块的requires.host约束,为空时不检查
+	HostVersion string
+	// 模块名称不包含所属组时使用的组
+	DefaultGroup string
+	// 访问模块仓储的http设置
+	HTTP pkg.HTTPOptions
+	// 额外的模块仓储,查询版本时与默认仓储合并,下载失败时按优先级依次尝试
+	Feeds []FeedSource
+	// 保存各个feed凭据的netrc格式文件,未在配置中指定认证信息的feed从中读取凭据
+	CredentialsFile string
+	// 读取与保存凭据的外部程序,指定后代替CredentialsFile
+	CredentialHelper string
+	// 超过该大小(字节)的模块包分块上传,为0时不分块
+	UploadChunkThreshold int64
+	// 分块上传时每块的大小(字节),为0时使用默认大小
+	UploadChunkSize int64
+
+	_httpClient *http.Client
+}
+
+// 额外的模块仓储
+type FeedSource struct {
+	// 为空时与默认仓储相同
+	SourceUrl string
+	// 为空时与默认仓储的feed名称相同
+	FeedName string
+	// 为空时不使用认证信息
+	Auth pkg.AuthOptions
+	// basic认证的用户名与密码,不为nil时代替Auth
+	//
+	// Deprecated: 使用Auth.
+	Authentication *[2]string
+	// 值越小越优先,默认仓储的优先级为0
+	Priority int
 }
 
 func defaultConfiguration() *Configuration {
@@ -42,20 +111,79 @@ func defaultConfiguration() *Configuration {
 	//先读取环境变量
 	config.SetSourceFeedUrl(getEnvKey(_envKeySourceUrl), getEnvKey(_envKeyFeedName))
 	config.SetAppPackageRegistryPath("plugins")
-	config.Authentication = getAuthentication(getEnvKey(_envKeyApiKey))
+	authEnvKeys := map[string]string{
+		"apiKey":    _envKeyApiKey,
+		"authType":  _envKeyAuthType,
+		"username":  _envKeyUsername,
+		"password":  _envKeyPassword,
+		"token":     _envKeyToken,
+		"tokenEnv":  _envKeyTokenEnv,
+		"tokenFile": _envKeyTokenFile,
+	}
+	readAuthOptions(&config.Auth, func(key string) string {
+		return getEnvKey(authEnvKeys[key])
+	})
+	config.CredentialsFile = defaultCredentialsFile()
+	if credentialsFile := getEnvKey(_envKeyCredentialsFile); len(credentialsFile) > 0 {
+		config.CredentialsFile = credentialsFile
+	}
+	config.CredentialHelper = getEnvKey(_envKeyCredentialHelper)
+	config.readUploadOptions(func(key string) interface{} {
+		if value := getEnvKey(map[string]string{
+			"uploadChunkThreshold": _envKeyUploadChunkThreshold,
+			"uploadChunkSize":      _envKeyUploadChunkSize,
+		}[key]); len(value) > 0 {
+			return value
+		}
+		return nil
+	})
+	if hostVersion := getEnvKey(_envKeyHostVersion); len(hostVersion) > 0 {
+		config.HostVersion = hostVersion
+	}
+	config.DefaultGroup = _defaultPluginGroupName
+	if group := getEnvKey(_envKeyGroup); len(group) > 0 {
+		config.DefaultGroup = group
+	}
+	config.HTTP = pkg.DefaultHTTPOptions()
+	httpEnvKeys := map[string]string{
+		"connectTimeout": _envKeyConnectTimeout,
+		"readTimeout":    _envKeyReadTimeout,
+		"proxy":          _envKeyProxy,
+		"caFile":         _envKeyCAFile,
+		"clientCert":     _envKeyClientCert,
+		"clientKey":      _envKeyClientKey,
+		"insecure":       _envKeyInsecure,
+	}
+	config.readHTTPOptions(func(key string) interface{} {
+		if value := getEnvKey(httpEnvKeys[key]); len(value) > 0 {
+			return value
+		}
+		return nil
+	})
+	if feeds := getEnvKey(_envKeyFeeds); len(feeds) > 0 {
+		var list []interface{}
+		if err := json.Unmarshal([]byte(feeds), &list); err != nil {
+			fmt.Fprintf(os.Stderr, "无效的模块仓储列表设置: %v\n", err)
+		} else {
+			config.readFeeds(list)
+		}
+	}
 
 	m := make(map[string]interface{})
 	data, err := readJsonFile(getCurrentDirectory() + "/plugininstaller.json")
-	if err != nil {
-		return config
+	if err == nil {
+		err = json.Unmarshal(data, &m)
 	}
-	err = json.Unmarshal(data, &m)
-	if err != nil {
-		return config
+	if err == nil {
+		insensitiviseMap(m)
+		config.readFromConfig(m)
 	}
-	insensitiviseMap(m)
-	config.readFromConfig(m)
 
+	config.Authentication = basicAuthentication(config.Auth)
+	//嵌入的应用通过WithAppVersion设置的版本优先于环境变量与配置文件
+	if len(_hostVersion) > 0 {
+		config.HostVersion = _hostVersion
+	}
 	return config
 }
 
@@ -67,14 +195,10 @@ func defaultConfigurationWithFeedName(feedName string) Configuration {
 
 // 从key/value配置中读取配置信息
 func (c *Configuration) readFromConfig(properties map[string]interface{}) {
-	apiKey, ok := properties[getConfigKey("apiKey")].(string)
-	if ok && len(apiKey) > 0 {
-		if c.Authentication == nil {
-			c.Authentication = &[2]string{}
-		}
-		c.Authentication[0] = "api"
-		c.Authentication[1] = apiKey
-	}
+	readAuthOptions(&c.Auth, func(key string) string {
+		value, _ := properties[getConfigKey(key)].(string)
+		return value
+	})
 
 	//url
 	sourceUrl, _ := properties[getConfigKey("sourceUrl")].(string)
@@ -82,6 +206,134 @@ func (c *Configuration) readFromConfig(properties map[string]interface{}) {
 	if len(sourceUrl) > 0 || len(sourceFeedName) > 0 {
 		c.SetSourceFeedUrl(sourceUrl, sourceFeedName)
 	}
+
+	hostVersion, _ := properties[getConfigKey("hostVersion")].(string)
+	if len(hostVersion) > 0 {
+		c.HostVersion = hostVersion
+	}
+
+	group, _ := properties[getConfigKey("group")].(string)
+	if len(group) > 0 {
+		c.DefaultGroup = group
+	}
+
+	credentialsFile, _ := properties[getConfigKey("credentialsFile")].(string)
+	if len(credentialsFile) > 0 {
+		c.CredentialsFile = credentialsFile
+	}
+	credentialHelper, _ := properties[getConfigKey("credentialHelper")].(string)
+	if len(credentialHelper) > 0 {
+		c.CredentialHelper = credentialHelper
+	}
+
+	c.readUploadOptions(func(key string) interface{} {
+		return properties[getConfigKey(key)]
+	})
+
+	c.readHTTPOptions(func(key string) interface{} {
+		return properties[getConfigKey(key)]
+	})
+
+	if feeds, ok := properties[getConfigKey("feeds")].([]interface{}); ok {
+		c.readFeeds(feeds)
+	}
+}
+
+// 读取额外的模块仓储列表,每一项包含sourceUrl、feedName、priority以及与默认仓储相同的认证设置
+func (c *Configuration) readFeeds(list []interface{}) {
+	c.Feeds = nil
+	for _, item := range list {
+		properties, ok := item.(map[string]interface{})
+		if !ok {
+			fmt.Fprintf(os.Stderr, "无效的模块仓储设置: %v\n", item)
+			continue
+		}
+		insensitiviseMap(properties)
+		source := FeedSource{}
+		source.SourceUrl, _ = properties["sourceurl"].(string)
+		source.FeedName, _ = properties["feedname"].(string)
+		readAuthOptions(&source.Auth, func(key string) string {
+			value, _ := properties[strings.ToLower(key)].(string)
+			return value
+		})
+		source.Authentication = basicAuthentication(source.Auth)
+		if priority, ok := properties["priority"].(float64); ok {
+			source.Priority = int(priority)
+		}
+		c.Feeds = append(c.Feeds, source)
+	}
+}
+
+// 为已弃用的Authentication字段生成basic认证的用户名与密码,不是basic认证时返回nil
+func basicAuthentication(auth pkg.AuthOptions) *[2]string {
+	authenticator, err := pkg.NewAuthenticator(auth)
+	if basic, ok := authenticator.(pkg.BasicAuthenticator); ok && err == nil {
+		return &[2]string{basic.Username, basic.Password}
+	}
+	return nil
+}
+
+// 设置了已弃用的Authentication字段时使用其中的用户名与密码进行basic认证
+func withAuthentication(auth pkg.AuthOptions, authentication *[2]string) pkg.AuthOptions {
+	if authentication == nil {
+		return auth
+	}
+	return pkg.AuthOptions{Type: pkg.AuthTypeBasic, Username: authentication[0], Password: authentication[1]}
+}
+
+// 读取认证设置:apiKey、authType(basic、apikey或bearer)、username、password、token、tokenEnv、tokenFile,
+// getValue返回空字符串时保留原有设置
+func readAuthOptions(options *pkg.AuthOptions, getValue func(key string) string) {
+	fields := map[string]*string{
+		"apiKey":    &options.APIKey,
+		"authType":  &options.Type,
+		"username":  &options.Username,
+		"password":  &options.Password,
+		"token":     &options.Token,
+		"tokenEnv":  &options.TokenEnv,
+		"tokenFile": &options.TokenFile,
+	}
+	for key, field := range fields {
+		if value := getValue(key); len(value) > 0 {
+			*field = value
+		}
+	}
+}
+
+// 读取分块上传设置,getValue返回nil时保留原有设置
+func (c *Configuration) readUploadOptions(getValue func(key string) interface{}) {
+	if size, ok := toSize(getValue("uploadChunkThreshold")); ok {
+		c.UploadChunkThreshold = size
+	}
+	if size, ok := toSize(getValue("uploadChunkSize")); ok {
+		c.UploadChunkSize = size
+	}
+}
+
+// 读取http设置,getValue返回nil时保留原有设置
+func (c *Configuration) readHTTPOptions(getValue func(key string) interface{}) {
+	if d, ok := toDuration(getValue("connectTimeout")); ok {
+		c.HTTP.ConnectTimeout = d
+	}
+	if d, ok := toDuration(getValue("readTimeout")); ok {
+		c.HTTP.ReadTimeout = d
+	}
+	if proxy, ok := getValue("proxy").(string); ok && len(proxy) > 0 {
+		c.HTTP.Proxy = proxy
+	}
+	if caFile, ok := getValue("caFile").(string); ok && len(caFile) > 0 {
+		c.HTTP.CAFile = caFile
+	}
+	if clientCert, ok := getValue("clientCert").(string); ok && len(clientCert) > 0 {
+		c.HTTP.ClientCertFile = clientCert
+	}
+	if clientKey, ok := getValue("clientKey").(string); ok && len(clientKey) > 0 {
+		c.HTTP.ClientKeyFile = clientKey
+	}
+	if insecure, ok := toBool(getValue("insecure")); ok {
+		c.HTTP.Insecure = insecure
+	}
+	c._httpClient = nil
 }
 
 func (c *Configuration) SetAppPackageRegistryPath(relativePath string) {
@@ -104,7 +356,100 @@ func (c *Configuration) SetSourceFeedName(feedName string) {
 	c.SetSourceFeedUrl(c.SourceUrl, feedName)
 }
 
+// 获取当前配置的模块仓储客户端
+func (c *Configuration) FeedClient() *pkg.FeedClient {
+	return c.newFeedClient(c.SourceFeedUrl, withAuthentication(c.Auth, c.Authentication))
+}
+
+// 创建使用http设置与上传设置的客户端,auth为空时从凭据文件或凭据程序中读取凭据
+func (c *Configuration) newFeedClient(feedUrl string, auth pkg.AuthOptions) *pkg.FeedClient {
+	feed := pkg.NewFeedClient(feedUrl, nil)
+	feed.Authenticator = c.feedAuthenticator(feedUrl, auth)
+	feed.HTTPClient = c.HTTPClient()
+	feed.UploadChunkThreshold = c.UploadChunkThreshold
+	feed.UploadChunkSize = c.UploadChunkSize
+	return feed
+}
+
+// 获取默认仓储的认证方式,未设置认证信息时返回nil,设置无效时所有请求都将返回错误
+func (c *Configuration) Authenticator() pkg.Authenticator {
+	return c.feedAuthenticator(c.SourceFeedUrl, withAuthentication(c.Auth, c.Authentication))
+}
+
+// 获取保存凭据的位置,指定了凭据程序时使用凭据程序
+func (c *Configuration) CredentialStore() pkg.CredentialStore {
+	if len(c.CredentialHelper) > 0 {
+		return pkg.CredentialHelper{Command: c.CredentialHelper}
+	}
+	return pkg.CredentialFile{Path: c.CredentialsFile}
+}
+
+// 配置中指定了认证信息时使用配置,否则在第一次请求时从凭据文件或凭据程序中读取feed的凭据
+func (c *Configuration) feedAuthenticator(feedUrl string, auth pkg.AuthOptions) pkg.Authenticator {
+	authenticator, err := pkg.NewAuthenticator(auth)
+	if err != nil || authenticator != nil {
+		return auth.Authenticator()
+	}
+	if _, ok := pkg.DirectoryFeedRoot(feedUrl); ok || len(feedUrl) <= 0 {
+		return nil
+	}
+	return pkg.NewCredentialAuthenticator(c.CredentialStore(), feedUrl)
+}
+
+// 获取默认仓储与额外仓储的客户端,按优先级排序,优先级相同时默认仓储在前
+func (c *Configuration) FeedClients() pkg.FeedSet {
+	type prioritized struct {
+		feed     *pkg.FeedClient
+		priority int
+	}
+	var feeds []prioritized
+	if len(c.SourceFeedUrl) > 0 {
+		feeds = append(feeds, prioritized{c.FeedClient(), 0})
+	}
+	for _, source := range c.Feeds {
+		sourceUrl, feedName := source.SourceUrl, source.FeedName
+		if len(sourceUrl) <= 0 {
+			sourceUrl = c.SourceUrl
+		}
+		if len(feedName) <= 0 {
+			feedName = c.SourceFeedName
+		}
+		feedUrl := getSourceFeedUrl(sourceUrl, feedName)
+		if len(feedUrl) <= 0 {
+			continue
+		}
+		feeds = append(feeds, prioritized{c.newFeedClient(feedUrl, withAuthentication(source.Auth, source.Authentication)), source.Priority})
+	}
+	sort.SliceStable(feeds, func(a, b int) bool {
+		return feeds[a].priority < feeds[b].priority
+	})
+
+	result := make(pkg.FeedSet, 0, len(feeds))
+	for _, feed := range feeds {
+		result = append(result, feed.feed)
+	}
+	return result
+}
+
+// 获取根据http设置创建的客户端,设置无效时客户端的所有请求都将返回错误
+func (c *Configuration) HTTPClient() *http.Client {
+	if c._httpClient == nil {
+		if c.HTTP.Insecure {
+			fmt.Fprintln(os.Stderr, "警告: 已关闭模块仓储的证书校验")
+		}
+		c._httpClient = c.HTTP.Client()
+	}
+	return c._httpClient
+}
+
 func getSourceFeedUrl(sourceUrl string, sourceFeedName string) string {
+	if _, ok := pkg.DirectoryFeedRoot(sourceUrl); ok {
+		//本地目录作为模块仓储时,feed名称为其中的子目录,可以为空
+		if len(sourceFeedName) <= 0 {
+			return sourceUrl
+		}
+		return strings.TrimRight(sourceUrl, "/\\") + "/" + sourceFeedName
+	}
 	if len(sourceUrl) <= 0 || len(sourceFeedName) <= 0 {
 		return ""
 	}
@@ -114,6 +459,15 @@ func getSourceFeedUrl(sourceUrl string, sourceFeedName string) string {
 	return strings.Join([]string{sourceUrl, sourceFeedName, "/"}, "")
 }
 
+// 默认的凭据文件,位于用户目录下
+func defaultCredentialsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "."+ConfigurationKey, "credentials")
+}
+
 func getEnvKey(key string) string {
 	value := os.Getenv(key)
 	if len(value) <= 0 {
@@ -124,9 +478,59 @@ func getEnvKey(key string) string {
 	return value
 }
 
-func getAuthentication(value string) *[2]string {
-	if len(value) <= 0 {
-		return nil
+// 将秒数或"30s"这样的时长字符串转换为时长
+func toDuration(value interface{}) (time.Duration, bool) {
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second)), true
+	case string:
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无效的超时时间设置: %s\n", v)
+			return 0, false
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// 将字节数或"100MB"这样的大小字符串转换为字节数,支持KB、MB、GB
+func toSize(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		s := strings.ToUpper(strings.TrimSpace(v))
+		unit := int64(1)
+		for _, suffix := range []struct {
+			name string
+			size int64
+		}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+			if strings.HasSuffix(s, suffix.name) {
+				s, unit = strings.TrimSpace(strings.TrimSuffix(s, suffix.name)), suffix.size
+				break
+			}
+		}
+		size, err := strconv.ParseFloat(s, 64)
+		if err != nil || size < 0 {
+			fmt.Fprintf(os.Stderr, "无效的大小设置: %s\n", v)
+			return 0, false
+		}
+		return int64(size * float64(unit)), true
+	}
+	return 0, false
+}
+
+func toBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
 	}
-	return &[2]string{"api", value}
+	return false, false
 }
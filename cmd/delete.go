@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+type Delete struct {
+	//模块所属组、名称、版本的组合名称,如plugins/quartz@2.2.0;指定Range时版本可以是约束,删除所有满足约束的版本,如plugins/quartz@<2.0
+	PackageName    string
+	SourceFeedName string
+	//版本为约束,删除所有满足约束的版本
+	Range bool
+	//不提示确认,直接删除
+	Yes bool
+	//只列出将要删除的版本
+	DryRun bool
+
+	_configuration Configuration
+}
+
+func (*Delete) Name() string { return "delete" }
+func (*Delete) Description() string {
+	return "从模块仓储中删除模块的指定版本."
+}
+
+func (d *Delete) Help() string  { return pkg.DefaultCommandHelp(d) }
+func (d *Delete) Usage() string { return pkg.DefaultCommandUsage(d) }
+
+func (*Delete) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "package",
+			Description: "模块所属组、名称、版本的组合名称,格式使用: 所属组/名称@版本,如plugins/quartz@2.2.0;指定--range时版本可以是约束,如plugins/quartz@<2.0,将删除所有满足约束的版本.",
+			Index:       0,
+			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
+				return &cmd.(*Delete).PackageName
+			}),
+		},
+	}
+}
+
+func (*Delete) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "feed",
+			Description: "模块仓储feed名称,为空时使用默认配置.",
+			TrySetValue: pkg.TrySetStringValue("feed", func(cmd pkg.Command) *string {
+				return &cmd.(*Delete).SourceFeedName
+			}),
+		},
+		{
+			Name:        "range",
+			Description: "版本为约束,删除所有满足约束的版本;未指定时必须使用精确的版本.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("range", func(cmd pkg.Command) *bool {
+				return &cmd.(*Delete).Range
+			}),
+		},
+		{
+			Name:        "yes",
+			Alias:       []string{"y"},
+			Description: "不提示确认,直接删除.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("yes", func(cmd pkg.Command) *bool {
+				return &cmd.(*Delete).Yes
+			}),
+		},
+		{
+			Name:        "dry-run",
+			Description: "只列出将要删除的版本,不执行删除.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("dry-run", func(cmd pkg.Command) *bool {
+				return &cmd.(*Delete).DryRun
+			}),
+		},
+	}
+}
+
+func (d *Delete) Run() int {
+	info, err := parsePackageNameWithVersion(d.PackageName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(info.version) <= 0 {
+		fmt.Fprintln(os.Stderr, "必须指定要删除的版本或版本约束,如plugins/quartz@2.2.0或plugins/quartz@<2.0 --range")
+		return 2
+	}
+	//避免误将1.0这样的部分版本当作约束删除多个版本
+	if !d.Range && !pkg.IsExactVersion(info.version) {
+		fmt.Fprintf(os.Stderr, "%s不是精确的版本,删除所有满足约束的版本时需要指定--range\n", info.version)
+		return 2
+	}
+
+	if len(d.SourceFeedName) > 0 {
+		d._configuration = defaultConfigurationWithFeedName(d.SourceFeedName)
+	} else {
+		d._configuration = *defaultConfiguration()
+	}
+	if len(info.group) <= 0 {
+		info.group = d._configuration.DefaultGroup
+	}
+
+	ctx := context.Background()
+	feed := d._configuration.FeedClient()
+	versions, err := findMatchingVersions(ctx, feed, info.group, info.name, info.version)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	packageName := groupAndName(info.group, info.name)
+	if len(versions) <= 0 {
+		if pkg.IsExactVersion(info.version) {
+			fmt.Fprintf(os.Stderr, "模块仓储中不存在%s@%s\n", packageName, info.version)
+			return 1
+		}
+		fmt.Println("没有满足", info.version, "的版本")
+		return 0
+	}
+
+	fmt.Printf("将从%s中删除%s的以下%d个版本:\n", d._configuration.SourceFeedUrl, packageName, len(versions))
+	for _, version := range versions {
+		fmt.Println("  " + version.String())
+	}
+	if d.DryRun {
+		return 0
+	}
+	if !d.Yes && !confirm(os.Stdin, "确认删除?") {
+		fmt.Println("已取消")
+		return 1
+	}
+
+	var failed int
+	for _, version := range versions {
+		err = feed.Delete(ctx, info.group, info.name, version.String())
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "删除%s@%s失败: %v\n", packageName, version, err)
+			continue
+		}
+		fmt.Println(packageName, version.String(), "deleted!")
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// 查找满足版本或版本约束的所有版本,包括预发布版本,按版本号从高到低排序
+func findMatchingVersions(ctx context.Context, feed *pkg.FeedClient, group, name, version string) ([]*pkg.UniversalPackageVersion, error) {
+	constraint, err := pkg.ParseVersionConstraint(version)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := feed.GetPackageVersions(ctx, group, name)
+	if err != nil {
+		if pkg.IsNotFound(err) {
+			return nil, fmt.Errorf("模块仓储中不存在模块%s", groupAndName(group, name))
+		}
+		return nil, err
+	}
+
+	var exact *pkg.UniversalPackageVersion
+	if pkg.IsExactVersion(version) {
+		exact, _ = pkg.ParseUniversalPackageVersion(strings.TrimPrefix(strings.TrimSpace(version), "="))
+	}
+	var matched []*pkg.UniversalPackageVersion
+	for _, v := range versions {
+		if (exact != nil && v.Equals(exact)) || (exact == nil && constraint.Check(v)) {
+			matched = append(matched, v)
+		}
+	}
+	sort.Slice(matched, func(a, b int) bool {
+		return matched[a].Compare(matched[b]) > 0
+	})
+	return matched, nil
+}
+
+// 在终端中提示确认,输入y或yes时返回true
+func confirm(r io.Reader, prompt string) bool {
+	fmt.Print(prompt + " [y/N]: ")
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && len(answer) <= 0 {
+		fmt.Println()
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
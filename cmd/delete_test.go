@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+func TestDeleteRequiresRangeForConstraints(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	feedRoot := t.TempDir()
+	t.Setenv(_envKeySourceUrl, feedRoot)
+	for _, version := range []string{"1.0.0", "1.0.1", "1.1.0", "2.0.0"} {
+		writeTestPackage(t, feedRoot, "g", "a", version, version)
+	}
+	feed, err := resolveFeedClient(feedRoot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		packageName string
+		isRange     bool
+		exitCode    int
+		deleted     []string
+	}{
+		{"g/a@1.0", false, 2, nil},
+		{"g/a@<2", false, 2, nil},
+		{"g/a@1.0.0", false, 0, []string{"1.0.0"}},
+		{"g/a@1.0", true, 0, []string{"1.0.1"}},
+		{"g/a@<2", true, 0, []string{"1.1.0"}},
+	} {
+		d := &Delete{PackageName: test.packageName, Range: test.isRange, Yes: true}
+		if exitCode := d.Run(); exitCode != test.exitCode {
+			t.Errorf("%s (range %v): exit code = %d, want %d", test.packageName, test.isRange, exitCode, test.exitCode)
+		}
+		for _, version := range test.deleted {
+			if _, err := feed.GetVersion(context.Background(), "g", "a", version); !pkg.IsNotFound(err) {
+				t.Errorf("%s (range %v): %s was not deleted: %v", test.packageName, test.isRange, version, err)
+			}
+		}
+	}
+	if _, err = feed.GetVersion(context.Background(), "g", "a", "2.0.0"); err != nil {
+		t.Errorf("2.0.0 should not be deleted: %v", err)
+	}
+}
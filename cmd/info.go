@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+type Info struct {
+	//模块所属组、名称、版本的组合名称,如plugins/quartz@2.2.0,不包含所属组时使用配置中的默认组,版本为空时显示最新版本的upack.json
+	PackageName    string
+	SourceFeedName string
+	Output         string
+
+	_configuration Configuration
+}
+
+type packageDetail struct {
+	Group           string                        `json:"group,omitempty"`
+	Name            string                        `json:"name"`
+	Title           string                        `json:"title,omitempty"`
+	Description     string                        `json:"description,omitempty"`
+	LatestVersion   string                        `json:"latestVersion,omitempty"`
+	Downloads       int64                         `json:"downloads,omitempty"`
+	Versions        []*pkg.RemotePackageVersion   `json:"versions"`
+	ManifestVersion string                        `json:"manifestVersion,omitempty"`
+	Manifest        *pkg.UniversalPackageMetadata `json:"manifest,omitempty"`
+}
+
+func (*Info) Name() string { return "info" }
+func (*Info) Description() string {
+	return "查看模块仓储中模块的详细信息与所有版本."
+}
+
+func (i *Info) Help() string  { return pkg.DefaultCommandHelp(i) }
+func (i *Info) Usage() string { return pkg.DefaultCommandUsage(i) }
+
+func (*Info) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "package",
+			Description: "模块所属组、名称、版本的组合名称,格式使用: 所属组/名称@版本,所属组与版本可为空,版本用于选择显示哪个版本的upack.json.",
+			Index:       0,
+			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
+				return &cmd.(*Info).PackageName
+			}),
+		},
+	}
+}
+
+func (*Info) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "feed",
+			Description: "模块仓储feed名称,为空时使用默认配置.",
+			TrySetValue: pkg.TrySetStringValue("feed", func(cmd pkg.Command) *string {
+				return &cmd.(*Info).SourceFeedName
+			}),
+		},
+		{
+			Name:        "output",
+			Description: "输出格式: text(默认)、json.",
+			TrySetValue: pkg.TrySetStringValue("output", func(cmd pkg.Command) *string {
+				return &cmd.(*Info).Output
+			}),
+		},
+	}
+}
+
+func (i *Info) Run() int {
+	output, err := parseOutputFormat(i.Output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(i.SourceFeedName) > 0 {
+		i._configuration = defaultConfigurationWithFeedName(i.SourceFeedName)
+	} else {
+		i._configuration = *defaultConfiguration()
+	}
+
+	info, err := parsePackageNameWithVersion(i.PackageName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(info.group) <= 0 {
+		info.group = i._configuration.DefaultGroup
+	}
+
+	detail, err := i.getPackageDetail(context.Background(), info)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if output == OutputJSON {
+		err = printJSON(detail)
+	} else {
+		err = printPackageDetail(detail)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func (i *Info) getPackageDetail(ctx context.Context, info *packageInfo) (*packageDetail, error) {
+	feed := i._configuration.FeedClient()
+	remote, err := feed.GetPackage(ctx, info.group, info.name)
+	if err != nil {
+		if pkg.IsNotFound(err) {
+			return nil, fmt.Errorf("模块仓储中不存在模块%s", groupAndName(info.group, info.name))
+		}
+		return nil, err
+	}
+	versions, err := feed.ListVersions(ctx, info.group, info.name)
+	if err != nil {
+		return nil, err
+	}
+	sortRemoteVersionsDescending(versions)
+
+	detail := &packageDetail{
+		Group:         remote.Group,
+		Name:          remote.Name,
+		Title:         remote.Title,
+		Description:   remote.Description,
+		LatestVersion: remote.LatestVersion,
+		Downloads:     remote.Downloads,
+		Versions:      versions,
+	}
+	if len(detail.Group) <= 0 {
+		detail.Group = info.group
+	}
+
+	detail.ManifestVersion, err = selectManifestVersion(versions, info.version)
+	if err != nil {
+		return nil, err
+	}
+	if len(detail.ManifestVersion) > 0 {
+		detail.Manifest, err = feed.GetManifest(ctx, info.group, info.name, detail.ManifestVersion)
+		if err != nil {
+			return nil, fmt.Errorf("读取%s@%s的upack.json失败: %v", groupAndName(info.group, info.name), detail.ManifestVersion, err)
+		}
+	}
+	return detail, nil
+}
+
+// 按版本号从高到低排序,无法解析的版本号排在最后
+func sortRemoteVersionsDescending(versions []*pkg.RemotePackageVersion) {
+	parsed := make(map[*pkg.RemotePackageVersion]*pkg.UniversalPackageVersion, len(versions))
+	for _, v := range versions {
+		parsed[v], _ = pkg.ParseUniversalPackageVersion(v.Version)
+	}
+	sort.SliceStable(versions, func(a, b int) bool {
+		va, vb := parsed[versions[a]], parsed[versions[b]]
+		if va == nil || vb == nil {
+			return vb == nil && va != nil
+		}
+		return va.Compare(vb) > 0
+	})
+}
+
+// 选择显示upack.json的版本,未指定时使用最新的正式版本,没有正式版本时使用最新的预发布版本
+func selectManifestVersion(versions []*pkg.RemotePackageVersion, version string) (string, error) {
+	var all []*pkg.UniversalPackageVersion
+	for _, v := range versions {
+		if parsed, err := pkg.ParseUniversalPackageVersion(v.Version); err == nil {
+			all = append(all, parsed)
+		}
+	}
+
+	constraint, err := pkg.ParseVersionConstraint(version)
+	if err != nil {
+		return "", err
+	}
+	if pkg.IsExactVersion(version) {
+		exact, _ := pkg.ParseUniversalPackageVersion(strings.TrimPrefix(strings.TrimSpace(version), "="))
+		for _, v := range all {
+			if v.Equals(exact) {
+				return v.String(), nil
+			}
+		}
+		return "", fmt.Errorf("模块仓储中不存在版本%s", version)
+	}
+
+	latest := constraint.Latest(all, false)
+	if latest == nil {
+		latest = constraint.Latest(all, true)
+	}
+	if latest == nil {
+		if len(version) > 0 {
+			return "", fmt.Errorf("没有满足%s的版本", version)
+		}
+		return "", nil
+	}
+	return latest.String(), nil
+}
+
+func printPackageDetail(detail *packageDetail) error {
+	fmt.Println(groupAndName(detail.Group, detail.Name))
+	if len(detail.Title) > 0 {
+		fmt.Println("Title:", detail.Title)
+	}
+	if len(detail.Description) > 0 {
+		fmt.Println("Description:", detail.Description)
+	}
+	if len(detail.LatestVersion) > 0 {
+		fmt.Println("Latest version:", detail.LatestVersion)
+	}
+	fmt.Println("Downloads:", detail.Downloads)
+
+	fmt.Println()
+	fmt.Println("Versions:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  VERSION\tPUBLISHED\tSIZE\tSHA1")
+	for _, v := range detail.Versions {
+		published := v.Published
+		if date, ok := v.PublishedDate(); ok {
+			published = date.Local().Format("2006-01-02 15:04:05")
+		}
+		version := v.Version
+		if parsed, err := pkg.ParseUniversalPackageVersion(v.Version); err == nil && parsed.Prerelease != "" {
+			version += " (prerelease)"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", version, published, pkg.FormatBytes(v.Size), v.SHA1)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if detail.Manifest == nil {
+		return nil
+	}
+	fmt.Println()
+	if dependencies := detail.Manifest.Dependencies(); len(dependencies) > 0 {
+		fmt.Printf("Dependencies (%s):\n", detail.ManifestVersion)
+		for _, dependency := range dependencies {
+			fmt.Println("  " + dependency)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Manifest (%s):\n", detail.ManifestVersion)
+	return printJSON(detail.Manifest)
+}
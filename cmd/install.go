@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/shanluzhineng/upack/pkg"
 )
@@ -16,19 +19,47 @@ const (
 	_defaultPrerelease         = false
 	_defaultPreserveTimestamps = true
 	_defaultCachePackages      = false
+	_defaultParallel           = 4
+)
+
+// --progress支持的输出方式
+const (
+	ProgressBar   = "bar"
+	ProgressQuiet = "quiet"
+	ProgressJSON  = "json"
 )
 
 type Install struct {
 	//模块所属组、名称、版本的组合名称, 格式使用: 所属组/名称@版本，版本可为空，如system/quartz@2.2.0,system/quartz@2.*"
 	PackageName    string
 	SourceFeedName string
+	//安装目录,为空时安装到插件目录下的 所属组/名称/版本 目录中
+	TargetDirectory string
+	//模块清单文件路径,指定后将安装清单中列出的所有模块
+	File string
+	//使用模块清单安装时,是否同时卸载清单中不存在的已注册模块
+	Sync bool
+	//使用模块清单安装时,同时下载与解压的模块数量
+	Parallel int
 
 	Type PackageType
+	//是否禁止执行upack.json中声明的hooks脚本
+	NoScripts bool
+	//下载与解压进度的输出方式: bar、quiet、json
+	Progress string
 	//下载的包的元数据
 	_metadata        *pkg.UniversalPackageMetadata
 	_registry        pkg.Registry
 	_packageInfo     *packageInfo
+	_version         *pkg.UniversalPackageVersion
 	_targetDirectory string
+	//安装前已注册的同名模块的版本
+	_previousVersion string
+	_progress        pkg.ProgressReporter
+	//实际提供模块包的feed
+	_servedFeed *pkg.FeedClient
+	//不为空时代替模块包的实际来源记录到注册表中,如从离线包安装时记录离线包的路径
+	_origin string
 
 	//配置信息
 	_configuration Configuration
@@ -46,8 +77,9 @@ func (*Install) PositionalArguments() []pkg.PositionalArgument {
 	return []pkg.PositionalArgument{
 		{
 			Name:        "package",
-			Description: "模块所属组、名称、版本的组合名称, 格式使用: 所属组/名称@版本,版本可为空,如system/quartz@2.2.0,system/quartz@2.*",
+			Description: "模块所属组、名称、版本的组合名称, 格式使用: 所属组/名称@版本,版本可为空,如system/quartz@2.2.0,system/quartz@2.*;也可以是本地.upack文件路径或http(s)地址",
 			Index:       0,
+			Optional:    true,
 			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
 				return &cmd.(*Install).PackageName
 			}),
@@ -56,7 +88,46 @@ func (*Install) PositionalArguments() []pkg.PositionalArgument {
 }
 
 func (*Install) ExtraArguments() []pkg.ExtraArgument {
-	return nil
+	return []pkg.ExtraArgument{
+		{
+			Name:        "no-scripts",
+			Description: "不执行upack.json中声明的hooks脚本.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("no-scripts", func(cmd pkg.Command) *bool {
+				return &cmd.(*Install).NoScripts
+			}),
+		},
+		{
+			Name:        "file",
+			Alias:       []string{"f"},
+			Description: "模块清单文件(json或yaml),安装清单中列出的所有模块,如--file=plugins.json或-f plugins.json.",
+			TrySetValue: pkg.TrySetPathValue("file", func(cmd pkg.Command) *string {
+				return &cmd.(*Install).File
+			}),
+		},
+		{
+			Name:        "sync",
+			Description: "与--file一起使用,卸载清单中不存在的已注册模块.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("sync", func(cmd pkg.Command) *bool {
+				return &cmd.(*Install).Sync
+			}),
+		},
+		{
+			Name:        "parallel",
+			Description: "与--file一起使用,同时下载与解压的模块数量,默认为4.",
+			TrySetValue: pkg.TrySetIntValue("parallel", func(cmd pkg.Command) *int {
+				return &cmd.(*Install).Parallel
+			}),
+		},
+		{
+			Name:        "progress",
+			Description: "下载与解压进度的输出方式: bar(默认)、quiet、json.",
+			TrySetValue: pkg.TrySetStringValue("progress", func(cmd pkg.Command) *string {
+				return &cmd.(*Install).Progress
+			}),
+		},
+	}
 }
 
 // 设置默认属性
@@ -73,32 +144,116 @@ func (i *Install) setupDefaultProperties() {
 }
 
 func (i *Install) Run() int {
-	i.setupDefaultProperties()
+	if _, err := newProgressReporter(i.Progress, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(i.File) > 0 {
+		return i.runManifest()
+	}
+	if len(i.PackageName) <= 0 {
+		fmt.Fprintln(os.Stderr, i.Help())
+		return 2
+	}
+	if i.Sync {
+		fmt.Fprintln(os.Stderr, "--sync只能与--file一起使用.")
+		return 2
+	}
 
-	r, size, done, err := i.OpenPackage()
+	err := i.install()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
+	return 0
+}
+
+// 下载、解压并注册一个模块
+func (i *Install) install() error {
+	i.setupDefaultProperties()
+
+	r, size, done, err := i.OpenPackage()
+	if err != nil {
+		return err
+	}
 	defer done()
 
 	zip, err := zip.NewReader(r, size)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return err
 	}
 
 	i._targetDirectory = i.formatTargetPath(i._packageInfo)
-	err = pkg.UnpackZip(i._targetDirectory, _defaultOverwrite, zip, _defaultPrerelease)
+	err = i.runPreInstallHook(zip)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return err
+	}
+	err = pkg.UnpackZipWithProgress(i._targetDirectory, _defaultOverwrite, zip, _defaultPrerelease, i.progressReporter())
+	if err != nil {
+		return err
 	}
 
-	return 0
+	err = i.runInstallHooks()
+	if err != nil {
+		return err
+	}
+
+	if i.Type == PackageType_Plugin {
+		return i._registry.SaveInstalledManifest(i._packageInfo.group, i._packageInfo.name, i._version, i._metadata)
+	}
+	return nil
+}
+
+func (i *Install) hookEnvironment() pkg.HookEnvironment {
+	return pkg.HookEnvironment{
+		Group:           i._packageInfo.group,
+		Name:            i._packageInfo.name,
+		Version:         i._packageInfo.version,
+		PreviousVersion: i._previousVersion,
+		TargetDirectory: i._targetDirectory,
+		Progress:        i.progressReporter(),
+	}
+}
+
+// 解压前执行preInstall,失败时不解压
+func (i *Install) runPreInstallHook(zipFile *zip.Reader) error {
+	if i.NoScripts || i._metadata == nil {
+		return nil
+	}
+	return pkg.RunHookFromZip(i._metadata, pkg.HookPreInstall, zipFile, i.hookEnvironment())
+}
+
+// 执行解压后的安装钩子,从较低的版本升级时额外执行postUpgrade,降级时不执行
+func (i *Install) runInstallHooks() error {
+	if i.NoScripts || i._metadata == nil {
+		return nil
+	}
+	env := i.hookEnvironment()
+	hookNames := []string{pkg.HookPostInstall}
+	if isUpgrade(i._previousVersion, i._version) {
+		hookNames = append(hookNames, pkg.HookPostUpgrade)
+	}
+	for _, hookName := range hookNames {
+		err := pkg.RunHook(i._metadata, hookName, env)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (i *Install) OpenPackage() (io.ReaderAt, int64, func() error, error) {
+	if isPackageFileOrURL(i.PackageName) {
+		f, done, origin, err := i.openPackageFileOrURL(i.PackageName)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if len(i._origin) > 0 {
+			origin = i._origin
+		}
+		return i.openDownloadedPackage(f, done, origin)
+	}
+
 	var version *pkg.UniversalPackageVersion
 
 	newPackageInfo, err := parsePackageNameWithVersion(i.PackageName)
@@ -109,41 +264,75 @@ func (i *Install) OpenPackage() (io.ReaderAt, int64, func() error, error) {
 	//保存解析的packageInfo
 	i._packageInfo = newPackageInfo
 
-	versionString, err := pkg.GetVersion(i._configuration.SourceFeedUrl,
-		newPackageInfo.group,
-		newPackageInfo.name,
-		newPackageInfo.version,
-		i._configuration.Authentication,
-		_defaultPrerelease)
-	if err != nil {
-		return nil, 0, nil, err
-	}
-	version, err = pkg.ParseUniversalPackageVersion(versionString)
+	version, err = i.resolveVersion(newPackageInfo)
 	if err != nil {
 		return nil, 0, nil, err
 	}
-
-	var userName *string
-	u, err := user.Current()
-	if err == nil {
-		userName = &u.Username
-	}
+	i._version = version
 
 	//version
 	newPackageInfo.version = version.String()
 
-	targetDirectory := i.formatTargetPath(newPackageInfo)
-
-	f, done, err := i._registry.GetOrDownload(newPackageInfo.group,
+	feeds := i._configuration.FeedClients()
+	for _, feed := range feeds {
+		feed.Progress = i.progressReporter()
+	}
+	f, done, served, err := i._registry.GetOrDownloadFromFeeds(feeds,
+		newPackageInfo.group,
 		newPackageInfo.name,
 		version,
-		i._configuration.SourceFeedUrl,
-		i._configuration.Authentication,
 		_defaultCachePackages)
 	if err != nil {
 		return nil, 0, nil, err
 	}
+	i._servedFeed = served
+
+	return i.openDownloadedPackage(f, done, served.FeedURL)
+}
 
+// 获取输出进度的对象
+func (i *Install) progressReporter() pkg.ProgressReporter {
+	if i._progress == nil {
+		i._progress, _ = newProgressReporter(i.Progress, false)
+	}
+	return i._progress
+}
+
+// 根据--progress创建输出进度的对象,multiple为true时有多个模块同时安装,不使用进度条
+func newProgressReporter(mode string, multiple bool) (pkg.ProgressReporter, error) {
+	switch strings.ToLower(mode) {
+	case "", ProgressBar:
+		if multiple {
+			return pkg.NewLineProgress(os.Stdout), nil
+		}
+		return pkg.NewTerminalProgress(os.Stdout), nil
+	case ProgressQuiet:
+		return pkg.QuietProgress{}, nil
+	case ProgressJSON:
+		return pkg.NewJSONProgress(os.Stdout), nil
+	}
+	return nil, fmt.Errorf("无效的进度输出方式: %s", mode)
+}
+
+// 输出每个模块的处理结果:--progress=json时作为json消息输出,保证标准输出中只有json,其它方式直接输出到标准输出
+func reportResult(progress pkg.ProgressReporter, stage, name, text string) {
+	if _, ok := progress.(*pkg.JSONProgress); ok {
+		pkg.ReportMessage(progress, stage, name, text)
+		return
+	}
+	fmt.Println(text)
+}
+
+// 汇总信息的输出位置,--progress=json时输出到标准错误
+func summaryWriter(progress pkg.ProgressReporter) io.Writer {
+	if _, ok := progress.(*pkg.JSONProgress); ok {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// 读取已下载模块包的元数据,检查宿主版本并注册到注册表中,origin为模块包的来源
+func (i *Install) openDownloadedPackage(f *os.File, done func() error, origin string) (io.ReaderAt, int64, func() error, error) {
 	fi, err := f.Stat()
 	if err != nil {
 		_ = done()
@@ -163,28 +352,118 @@ func (i *Install) OpenPackage() (io.ReaderAt, int64, func() error, error) {
 		}
 	}
 
+	if i._packageInfo == nil {
+		//从文件或url安装时,模块的组、名称与版本均来自upack.json
+		err = i.setPackageInfoFromManifest()
+		if err != nil {
+			_ = done()
+			return nil, 0, nil, err
+		}
+	}
+
+	if i._metadata != nil {
+		err = i._metadata.CheckHostVersion(i._configuration.HostVersion)
+		if err != nil {
+			_ = done()
+			return nil, 0, nil, err
+		}
+	}
+
 	if i.Type == PackageType_Plugin {
-		err = i._registry.RegisterPackage(newPackageInfo.group,
-			newPackageInfo.name,
-			version,
-			targetDirectory,
-			i._configuration.SourceFeedUrl,
-			i._configuration.Authentication,
+		var userName *string
+		u, err := user.Current()
+		if err == nil {
+			userName = &u.Username
+		}
+
+		i._previousVersion = findPreviousVersion(i._registry, i._packageInfo.group, i._packageInfo.name, i._version)
+		err = i._registry.RegisterPackage(i._packageInfo.group,
+			i._packageInfo.name,
+			i._version,
+			i.formatTargetPath(i._packageInfo),
+			origin,
+			nil,
 			nil,
 			nil,
 			userName)
 		if err != nil {
+			_ = done()
 			return nil, 0, nil, err
 		}
 	}
 	return f, fi.Size(), done, nil
 }
 
+// 解析需要安装的版本:指定了精确版本时直接使用,
+// 否则从新到旧查找满足版本约束的版本,配置了宿主版本时选择第一个兼容当前宿主的版本
+func (i *Install) resolveVersion(info *packageInfo) (*pkg.UniversalPackageVersion, error) {
+	if pkg.IsExactVersion(info.version) {
+		return pkg.ParseUniversalPackageVersion(strings.TrimPrefix(strings.TrimSpace(info.version), "="))
+	}
+
+	versionConstraint := info.version
+	if strings.EqualFold(versionConstraint, "latest") {
+		versionConstraint = ""
+	}
+	constraint, err := pkg.ParseVersionConstraint(versionConstraint)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds := i._configuration.FeedClients()
+	versions, err := feeds.GetPackageVersions(context.Background(), info.group, info.name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(a, b int) bool {
+		return versions[a].Compare(versions[b]) > 0
+	})
+
+	var candidates []*pkg.UniversalPackageVersion
+	for _, version := range versions {
+		if !_defaultPrerelease && version.Prerelease != "" {
+			continue
+		}
+		if constraint.Check(version) {
+			candidates = append(candidates, version)
+		}
+	}
+	if len(candidates) <= 0 {
+		return nil, fmt.Errorf("模块%s/%s没有满足%s的版本", info.group, info.name, info.version)
+	}
+	if len(i._configuration.HostVersion) <= 0 {
+		return candidates[0], nil
+	}
+
+	//从最新的版本开始依次检查,无法读取upack.json的版本跳过
+	var lastErr error
+	for _, version := range candidates {
+		metadata, err := feeds.GetManifest(context.Background(), info.group, info.name, version.String())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无法读取模块%s/%s@%s的upack.json,跳过该版本: %v\n", info.group, info.name, version, err)
+			lastErr = err
+			continue
+		}
+		lastErr = metadata.CheckHostVersion(i._configuration.HostVersion)
+		if lastErr == nil {
+			return version, nil
+		}
+	}
+	return nil, fmt.Errorf("模块%s/%s没有兼容当前宿主版本%s的版本: %v", info.group, info.name, i._configuration.HostVersion, lastErr)
+}
+
 func (i *Install) InstalledPath() string {
 	return i._targetDirectory
 }
 
 func (i *Install) formatTargetPath(info *packageInfo) string {
+	if len(i.TargetDirectory) > 0 {
+		targetDirectory, err := filepath.Abs(i.TargetDirectory)
+		if err == nil {
+			return targetDirectory
+		}
+		return i.TargetDirectory
+	}
 	if i.Type != PackageType_Plugin {
 		//app，install current folder
 		return ""
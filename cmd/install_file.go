@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+// 判断安装的模块是否为本地.upack文件或http(s)地址,而不是 所属组/名称@版本.
+// 没有.upack扩展名的文件必须使用绝对路径或以./、../开头,
+// 避免当前目录中恰好存在与模块名称相同的文件时误当作模块包
+func isPackageFileOrURL(packageName string) bool {
+	if isPackageURL(packageName) {
+		return true
+	}
+	if strings.HasSuffix(strings.ToLower(packageName), ".upack") {
+		return true
+	}
+	if !isExplicitPath(packageName) {
+		return false
+	}
+	fi, err := os.Stat(packageName)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// 是否为绝对路径或以./、../开头的相对路径,组/名称形式的模块名称不是路径
+func isExplicitPath(packageName string) bool {
+	if filepath.IsAbs(packageName) {
+		return true
+	}
+	for _, prefix := range []string{"./", "../", `.\`, `..\`} {
+		if strings.HasPrefix(packageName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPackageURL(packageName string) bool {
+	lower := strings.ToLower(packageName)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// 打开本地.upack文件或下载http(s)地址指向的模块包,返回模块包来源
+func (i *Install) openPackageFileOrURL(packageName string) (*os.File, func() error, string, error) {
+	if !isPackageURL(packageName) {
+		packagePath, err := filepath.Abs(packageName)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		f, err := os.Open(packagePath)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return f, f.Close, "file:///" + strings.TrimPrefix(filepath.ToSlash(packagePath), "/"), nil
+	}
+
+	f, err := os.CreateTemp("", "upack")
+	if err != nil {
+		return nil, nil, "", err
+	}
+	tempFileName := f.Name()
+	done := func() error {
+		err := f.Close()
+		if e := os.Remove(tempFileName); err == nil {
+			err = e
+		}
+		return err
+	}
+
+	fmt.Println("downloading", packageName, "please waitting...")
+	err = i.downloadURL(f, packageName)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = done()
+		return nil, nil, "", err
+	}
+	return f, done, packageName, nil
+}
+
+func (i *Install) downloadURL(w io.Writer, packageURL string) error {
+	req, err := http.NewRequest("GET", packageURL, nil)
+	if err != nil {
+		return err
+	}
+
+	//只向配置的模块仓储发送授权信息
+	if pkg.IsFeedURL(i._configuration.SourceUrl, packageURL) {
+		if authenticator := i._configuration.Authenticator(); authenticator != nil {
+			if err = authenticator.Authenticate(req); err != nil {
+				return err
+			}
+		}
+	}
+
+	resp, err := pkg.RedirectSafeClient(i._configuration.HTTPClient()).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading package: %s", resp.Status)
+	}
+
+	progress := pkg.NewProgressTracker(i.progressReporter(), pkg.ProgressDownload, packageURL, resp.ContentLength)
+	_, err = io.Copy(io.MultiWriter(w, progress), resp.Body)
+	if err != nil {
+		return err
+	}
+	progress.Done()
+	return nil
+}
+
+// 根据upack.json设置模块的组、名称与版本
+func (i *Install) setPackageInfoFromManifest() error {
+	if i._metadata == nil {
+		return fmt.Errorf("%s不是有效的模块包: 缺少upack.json", i.PackageName)
+	}
+	err := pkg.ValidateManifest(i._metadata)
+	if err != nil {
+		return fmt.Errorf("%s中的upack.json无效: %v", i.PackageName, err)
+	}
+	version, err := pkg.ParseUniversalPackageVersion(i._metadata.Version())
+	if err != nil {
+		return err
+	}
+	i._version = version
+	i._packageInfo = &packageInfo{
+		group:   i._metadata.Group(),
+		name:    i._metadata.Name(),
+		version: version.String(),
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+const (
+	_installResultInstalled   = "installed"
+	_installResultFailed      = "failed"
+	_installResultUninstalled = "uninstalled"
+)
+
+// 清单中每个模块的安装结果
+type installResult struct {
+	PackageName string
+	Status      string
+	Err         error
+}
+
+// 安装模块清单中列出的所有模块,全部完成后输出汇总信息,任一模块失败时返回非0
+func (i *Install) runManifest() int {
+	manifest, err := readPluginsManifest(i.File)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	parallel := i.Parallel
+	if parallel <= 0 {
+		parallel = _defaultParallel
+	}
+
+	progress, _ := newProgressReporter(i.Progress, parallel > 1)
+
+	//并行下载与解压,注册表的读写由pkg.Registry串行处理
+	results := make([]installResult, len(manifest.Packages))
+	installCmds := make([]*Install, len(manifest.Packages))
+	var completed int32
+	parallelForEach(len(manifest.Packages), parallel, func(index int) {
+		entry := manifest.Packages[index]
+		installCmd := &Install{
+			PackageName:     entry.PackageName(),
+			SourceFeedName:  entry.Feed,
+			TargetDirectory: entry.Target,
+			NoScripts:       i.NoScripts,
+			Progress:        i.Progress,
+			_progress:       progress,
+		}
+		startTime := time.Now()
+		err := installCmd.install()
+		installCmds[index] = installCmd
+		results[index] = newInstallResult(installCmd, entry.PackageName(), err)
+
+		n := atomic.AddInt32(&completed, 1)
+		reportResult(progress, pkg.ProgressInstall, results[index].PackageName, fmt.Sprintf("[%d/%d] %s %s, elapsed time:%.0f seconds", n, len(manifest.Packages), results[index].Status, results[index].PackageName, time.Since(startTime).Seconds()))
+	})
+
+	//清单中的模块及本次安装的版本,安装失败时版本为空
+	expected := make(map[string]string, len(manifest.Packages))
+	//本次安装使用的目录,指定了target时不同版本可能安装到同一目录或者相互嵌套的目录
+	var installedPaths []string
+	for index, entry := range manifest.Packages {
+		info, err := parsePackageNameWithVersion(entry.PackageName())
+		if err == nil {
+			expected[strings.ToLower(info.group+"/"+info.name)] = ""
+		}
+		if results[index].Err == nil {
+			installCmd := installCmds[index]
+			expected[strings.ToLower(installCmd._packageInfo.group+"/"+installCmd._packageInfo.name)] = installCmd._version.String()
+			if len(installCmd._targetDirectory) > 0 {
+				installedPaths = append(installedPaths, installCmd._targetDirectory)
+			}
+		}
+	}
+
+	if i.Sync {
+		results = append(results, i.syncRegisteredPackages(expected, installedPaths, progress)...)
+	}
+
+	return printInstallResults(progress, results)
+}
+
+func newInstallResult(installCmd *Install, packageName string, err error) installResult {
+	if installCmd._packageInfo != nil && installCmd._version != nil {
+		packageName = installCmd._packageInfo.group + "/" + installCmd._packageInfo.name + "@" + installCmd._version.String()
+	}
+	if err != nil {
+		return installResult{PackageName: packageName, Status: _installResultFailed, Err: err}
+	}
+	return installResult{PackageName: packageName, Status: _installResultInstalled}
+}
+
+// 卸载插件目录中已注册但不在清单中的模块,以及清单中模块本次安装版本以外的其他版本;
+// 旧版本的目录与本次安装或者仍然注册的模块的目录相同、包含或者位于其中时只取消注册,不删除文件
+func (i *Install) syncRegisteredPackages(expected map[string]string, installedPaths []string, progress pkg.ProgressReporter) []installResult {
+	r := pkg.PlugIns
+	packages, err := r.ListInstalledPackages()
+	if err != nil {
+		return []installResult{{PackageName: string(r), Status: _installResultFailed, Err: err}}
+	}
+
+	var removed []*pkg.InstalledPackage
+	keptPaths := installedPaths
+	for _, installed := range packages {
+		version, ok := expected[strings.ToLower(installed.GroupAndName())]
+		if ok && (len(version) <= 0 || strings.EqualFold(version, installed.Version.String())) {
+			if installed.Path != nil {
+				keptPaths = append(keptPaths, *installed.Path)
+			}
+			continue
+		}
+		removed = append(removed, installed)
+	}
+
+	var results []installResult
+	for _, installed := range removed {
+		err = uninstallPackage(r, installed, keptPaths, i.NoScripts, progress)
+		if err != nil {
+			results = append(results, installResult{PackageName: installed.PackageName(), Status: _installResultFailed, Err: err})
+			continue
+		}
+		results = append(results, installResult{PackageName: installed.PackageName(), Status: _installResultUninstalled})
+	}
+	return results
+}
+
+// 用于比较的目录路径
+func pathKey(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	p = filepath.Clean(p)
+	if runtime.GOOS == "windows" {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// 两个目录相同,或者其中一个位于另一个之中
+func pathsOverlap(a, b string) bool {
+	a, b = pathKey(a), pathKey(b)
+	if a == b {
+		return true
+	}
+	return strings.HasPrefix(a, strings.TrimSuffix(b, string(filepath.Separator))+string(filepath.Separator)) ||
+		strings.HasPrefix(b, strings.TrimSuffix(a, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// 输出所有模块的安装结果,有失败的模块时返回1
+func printInstallResults(progress pkg.ProgressReporter, results []installResult) int {
+	var failed int
+	w := summaryWriter(progress)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Summary:")
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(w, "  %-12s %s: %v\n", result.Status, result.PackageName, result.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  %-12s %s\n", result.Status, result.PackageName)
+	}
+	fmt.Fprintln(w, len(results), "packages,", len(results)-failed, "succeeded,", failed, "failed")
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
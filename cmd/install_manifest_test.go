@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathsOverlap(t *testing.T) {
+	root := t.TempDir()
+	for _, test := range []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"out", "out", true},
+		{"out", "out/sub", true},
+		{"out/sub", "out", true},
+		{"out/", "out/sub/deeper", true},
+		{"out", "output", false},
+		{"out/a", "out/b", false},
+	} {
+		a, b := filepath.Join(root, test.a), filepath.Join(root, test.b)
+		if overlap := pathsOverlap(a, b); overlap != test.overlap {
+			t.Errorf("pathsOverlap(%s, %s) = %v, want %v", test.a, test.b, overlap, test.overlap)
+		}
+	}
+}
+
+func TestReadPluginsManifestResolvesTargetAgainstManifestDirectory(t *testing.T) {
+	dir := t.TempDir()
+	absolute := filepath.Join(t.TempDir(), "abs")
+	filename := filepath.Join(dir, "plugins.yaml")
+	data := "packages:\n  - package: g/a\n    target: custom/a\n  - package: g/b\n    target: " + absolute + "\n  - package: g/c\n"
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := readPluginsManifest(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, want := range []string{filepath.Join(dir, "custom", "a"), absolute, ""} {
+		if target := manifest.Packages[index].Target; target != want {
+			t.Errorf("%s: target = %q, want %q", manifest.Packages[index].Package, target, want)
+		}
+	}
+}
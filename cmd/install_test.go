@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 模块仓储中g/n的版本与其upack.json,值为空时upack.json无法解析
+func testResolveVersionFeed(t *testing.T, manifests map[string]string) *Install {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/upack/f/packages":
+			versions := make([]string, 0, len(manifests))
+			for version := range manifests {
+				versions = append(versions, version)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"group": "g", "name": "n", "versions": versions})
+		case strings.HasPrefix(r.URL.Path, "/upack/f/download-file/g/n/") && r.URL.Query().Get("path") == "upack.json":
+			manifest, ok := manifests[strings.TrimPrefix(r.URL.Path, "/upack/f/download-file/g/n/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if manifest == "" {
+				_, _ = io.WriteString(w, "not json")
+				return
+			}
+			_, _ = io.WriteString(w, manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("HOME", t.TempDir())
+
+	i := &Install{}
+	i._configuration.SetSourceFeedUrl(server.URL, "f")
+	return i
+}
+
+func TestInstallResolveVersion(t *testing.T) {
+	i := testResolveVersionFeed(t, map[string]string{
+		"4.0.0-beta": `{"group":"g","name":"n","version":"4.0.0-beta"}`,
+		"3.0.0":      `{"group":"g","name":"n","version":"3.0.0","requires":{"host":">=2"}}`,
+		"2.0.0":      "",
+		"1.5.0":      `{"group":"g","name":"n","version":"1.5.0","requires":{"host":"^1.2"}}`,
+		"1.0.0":      `{"group":"g","name":"n","version":"1.0.0"}`,
+	})
+	for _, test := range []struct {
+		version     string
+		hostVersion string
+		resolved    string
+		err         string
+	}{
+		{"", "", "3.0.0", ""},
+		{"latest", "", "3.0.0", ""},
+		{"^1.0", "", "1.5.0", ""},
+		{"<1.5", "", "1.0.0", ""},
+		{"=9.9.9", "", "9.9.9", ""},
+		{"^5", "", "", "没有满足^5的版本"},
+		// 3.0.0要求宿主>=2,2.0.0的upack.json无法读取,依次跳过
+		{"", "1.3", "1.5.0", ""},
+		{"", "1.0", "1.0.0", ""},
+		{"", "2.1", "3.0.0", ""},
+		{">=3", "1.3", "", "没有兼容当前宿主版本1.3的版本"},
+	} {
+		i._configuration.HostVersion = test.hostVersion
+		version, err := i.resolveVersion(&packageInfo{group: "g", name: "n", version: test.version})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q (host %s): expected error %q, got %v, %v", test.version, test.hostVersion, test.err, version, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q (host %s): %v", test.version, test.hostVersion, err)
+			continue
+		}
+		if version.String() != test.resolved {
+			t.Errorf("%q (host %s): resolved %s, want %s", test.version, test.hostVersion, version, test.resolved)
+		}
+	}
+}
+
+func TestIsPackageFileOrURL(t *testing.T) {
+	//当前目录中存在与模块名称相同的文件
+	directory := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(directory); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	if err = os.WriteFile("quartz", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		packageName string
+		isFile      bool
+	}{
+		{"quartz", false},
+		{"quartz@1.0.0", false},
+		{"plugins/quartz", false},
+		{"./quartz", true},
+		{"../" + filepath.Base(directory) + "/quartz", true},
+		{filepath.Join(directory, "quartz"), true},
+		{"./missing", false},
+		{"missing.upack", true},
+		{"dist/Quartz-1.0.0.UPACK", true},
+		{"https://example.com/quartz", true},
+	} {
+		if isFile := isPackageFileOrURL(test.packageName); isFile != test.isFile {
+			t.Errorf("isPackageFileOrURL(%q) = %v, want %v", test.packageName, isFile, test.isFile)
+		}
+	}
+}
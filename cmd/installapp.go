@@ -9,6 +9,10 @@ import (
 type InstallApp struct {
 	//应用名称, 格式使用: 所属组/名称@版本，[所属组]与[版本]可为空，如App/helloworld@2.*，如果不包含所属组，如helloworld，则将使用App组
 	PackageName string
+	//是否禁止执行upack.json中声明的hooks脚本
+	NoScripts bool
+	//下载与解压进度的输出方式: bar、quiet、json
+	Progress string
 }
 
 func (*InstallApp) Name() string { return "installapp" }
@@ -33,7 +37,23 @@ func (*InstallApp) PositionalArguments() []pkg.PositionalArgument {
 }
 
 func (*InstallApp) ExtraArguments() []pkg.ExtraArgument {
-	return nil
+	return []pkg.ExtraArgument{
+		{
+			Name:        "no-scripts",
+			Description: "不执行upack.json中声明的hooks脚本.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("no-scripts", func(cmd pkg.Command) *bool {
+				return &cmd.(*InstallApp).NoScripts
+			}),
+		},
+		{
+			Name:        "progress",
+			Description: "下载与解压进度的输出方式: bar(默认)、quiet、json.",
+			TrySetValue: pkg.TrySetStringValue("progress", func(cmd pkg.Command) *string {
+				return &cmd.(*InstallApp).Progress
+			}),
+		},
+	}
 }
 
 func (i *InstallApp) Run() int {
@@ -48,6 +68,8 @@ func (i *InstallApp) Run() int {
 	installCmd.PackageName = packageName
 	installCmd.SourceFeedName = _defaultAppSourceFeedName
 	installCmd.Type = PackageType_App
+	installCmd.NoScripts = i.NoScripts
+	installCmd.Progress = i.Progress
 
 	return installCmd.Run()
 }
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+type Login struct {
+	//feed名称或地址,为空时使用配置的模块仓储
+	Feed string
+	//basic认证的用户名,默认为api
+	Username string
+	//认证方式:basic、apikey或bearer
+	AuthType string
+	//从标准输入读取密钥
+	PasswordStdin bool
+	//从文件读取密钥
+	PasswordFile string
+}
+
+func (*Login) Name() string { return "login" }
+func (*Login) Description() string {
+	return "保存访问模块仓储的凭据,之后的命令不需要在配置或命令行中指定api key."
+}
+
+func (l *Login) Help() string  { return pkg.DefaultCommandHelp(l) }
+func (l *Login) Usage() string { return pkg.DefaultCommandUsage(l) }
+
+func (*Login) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "feed",
+			Description: "feed名称或地址,为空时使用配置的模块仓储.",
+			Index:       0,
+			Optional:    true,
+			TrySetValue: pkg.TrySetStringValue("feed", func(cmd pkg.Command) *string {
+				return &cmd.(*Login).Feed
+			}),
+		},
+	}
+}
+
+func (*Login) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "username",
+			Description: "basic认证的用户名,默认为api.",
+			TrySetValue: pkg.TrySetStringValue("username", func(cmd pkg.Command) *string {
+				return &cmd.(*Login).Username
+			}),
+		},
+		{
+			Name:        "auth-type",
+			Description: "认证方式:basic(默认)、apikey(X-ApiKey请求头)或bearer.",
+			TrySetValue: pkg.TrySetStringValue("auth-type", func(cmd pkg.Command) *string {
+				return &cmd.(*Login).AuthType
+			}),
+		},
+		{
+			Name:        "password-stdin",
+			Description: "从标准输入读取密码、api key或token.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("password-stdin", func(cmd pkg.Command) *bool {
+				return &cmd.(*Login).PasswordStdin
+			}),
+		},
+		{
+			Name:        "password-file",
+			Description: "从文件读取密码、api key或token.",
+			TrySetValue: pkg.TrySetPathValue("password-file", func(cmd pkg.Command) *string {
+				return &cmd.(*Login).PasswordFile
+			}),
+		},
+	}
+}
+
+func (l *Login) Run() int {
+	configuration := defaultConfiguration()
+	feedUrl, err := resolveCredentialFeedUrl(configuration, l.Feed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !l.PasswordStdin && len(l.PasswordFile) <= 0 {
+		fmt.Fprintln(os.Stderr, "请通过--password-stdin或--password-file指定密钥,避免密钥出现在命令行与进程列表中")
+		return 2
+	}
+	secret, err := readSecret(os.Stdin, l.PasswordStdin, l.PasswordFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	options := pkg.AuthOptions{Type: strings.ToLower(l.AuthType)}
+	switch options.Type {
+	case pkg.AuthTypeAPIKey:
+		options.APIKey = secret
+	case pkg.AuthTypeBearer:
+		options.Token = secret
+	default:
+		options.Username, options.Password = l.Username, secret
+		if len(options.Username) <= 0 {
+			options.Username = "api"
+		}
+	}
+	if _, err = pkg.NewAuthenticator(options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	err = configuration.CredentialStore().Store(feedUrl, options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("已保存%s的凭据到%s\n", feedUrl, credentialStoreName(configuration))
+	return 0
+}
+
+type Logout struct {
+	//feed名称或地址,为空时使用配置的模块仓储
+	Feed string
+}
+
+func (*Logout) Name() string { return "logout" }
+func (*Logout) Description() string {
+	return "删除login保存的模块仓储凭据."
+}
+
+func (l *Logout) Help() string  { return pkg.DefaultCommandHelp(l) }
+func (l *Logout) Usage() string { return pkg.DefaultCommandUsage(l) }
+
+func (*Logout) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "feed",
+			Description: "feed名称或地址,为空时使用配置的模块仓储.",
+			Index:       0,
+			Optional:    true,
+			TrySetValue: pkg.TrySetStringValue("feed", func(cmd pkg.Command) *string {
+				return &cmd.(*Logout).Feed
+			}),
+		},
+	}
+}
+
+func (*Logout) ExtraArguments() []pkg.ExtraArgument {
+	return nil
+}
+
+func (l *Logout) Run() int {
+	configuration := defaultConfiguration()
+	feedUrl, err := resolveCredentialFeedUrl(configuration, l.Feed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	err = configuration.CredentialStore().Erase(feedUrl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("已从%s删除%s的凭据\n", credentialStoreName(configuration), feedUrl)
+	return 0
+}
+
+// 解析feed参数:可以是feed名称或feed地址,为空时使用配置的模块仓储
+func resolveCredentialFeedUrl(configuration *Configuration, value string) (string, error) {
+	if len(value) <= 0 {
+		if len(configuration.SourceFeedUrl) <= 0 {
+			return "", fmt.Errorf("未配置模块仓储地址,请指定feed名称或地址")
+		}
+		return configuration.SourceFeedUrl, nil
+	}
+	if strings.Contains(value, "://") && !strings.HasPrefix(strings.ToLower(value), "file://") {
+		return value, nil
+	}
+	if strings.ContainsAny(value, `/\`) || strings.HasPrefix(value, ".") || strings.Contains(value, "://") {
+		return "", fmt.Errorf("本地目录feed不需要凭据: %s", value)
+	}
+	configuration.SetSourceFeedName(value)
+	if len(configuration.SourceFeedUrl) <= 0 {
+		return "", fmt.Errorf("未配置模块仓储地址,无法访问feed %s", value)
+	}
+	return configuration.SourceFeedUrl, nil
+}
+
+func credentialStoreName(configuration *Configuration) string {
+	if len(configuration.CredentialHelper) > 0 {
+		return "凭据程序" + configuration.CredentialHelper
+	}
+	return configuration.CredentialsFile
+}
+
+// 从标准输入的第一行或者文件中读取密钥,避免密钥出现在命令行与进程列表中
+func readSecret(stdin io.Reader, fromStdin bool, file string) (string, error) {
+	var secret string
+	if fromStdin {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		secret = strings.TrimSpace(line)
+	} else {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if len(secret) <= 0 {
+		return "", fmt.Errorf("密钥为空")
+	}
+	return secret, nil
+}
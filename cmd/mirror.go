@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+// 镜像结果中每个模块版本的状态
+const (
+	MirrorCopied  = "copied"
+	MirrorSkipped = "skipped"
+	MirrorFailed  = "failed"
+	MirrorPending = "pending"
+)
+
+type Mirror struct {
+	//源feed,可以是feed名称、feed地址或本地目录
+	From string
+	//目标feed,可以是feed名称、feed地址或本地目录
+	To string
+	//只复制指定组的模块
+	Group string
+	//只复制名称匹配的模块,支持*与?通配符
+	PackageName string
+	//只复制满足版本约束的版本,如>=2.0
+	Version string
+	//同时复制的模块数量
+	Parallel int
+	//json格式的复制报告保存路径
+	Report string
+	//只列出将要复制的版本
+	DryRun bool
+}
+
+type mirrorReport struct {
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Copied   int              `json:"copied"`
+	Skipped  int              `json:"skipped"`
+	Failed   int              `json:"failed"`
+	Packages []*mirrorPackage `json:"packages"`
+}
+
+type mirrorPackage struct {
+	Group   string `json:"group,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	SHA1    string `json:"sha1,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (*Mirror) Name() string { return "mirror" }
+func (*Mirror) Description() string {
+	return "将模块从一个feed复制到另一个feed或本地目录,目标中已存在且哈希值相同的版本将跳过."
+}
+
+func (m *Mirror) Help() string  { return pkg.DefaultCommandHelp(m) }
+func (m *Mirror) Usage() string { return pkg.DefaultCommandUsage(m) }
+
+func (*Mirror) PositionalArguments() []pkg.PositionalArgument {
+	return nil
+}
+
+func (*Mirror) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "from",
+			Description: "源feed,可以是feed名称、feed地址或本地目录.",
+			Required:    true,
+			TrySetValue: pkg.TrySetStringValue("from", func(cmd pkg.Command) *string {
+				return &cmd.(*Mirror).From
+			}),
+		},
+		{
+			Name:        "to",
+			Description: "目标feed,可以是feed名称、feed地址或本地目录,目录不存在时自动创建.",
+			Required:    true,
+			TrySetValue: pkg.TrySetStringValue("to", func(cmd pkg.Command) *string {
+				return &cmd.(*Mirror).To
+			}),
+		},
+		{
+			Name:        "group",
+			Description: "只复制指定组的模块.",
+			TrySetValue: pkg.TrySetStringValue("group", func(cmd pkg.Command) *string {
+				return &cmd.(*Mirror).Group
+			}),
+		},
+		{
+			Name:        "name",
+			Description: "只复制名称匹配的模块,支持*与?通配符,如quartz*.",
+			TrySetValue: pkg.TrySetStringValue("name", func(cmd pkg.Command) *string {
+				return &cmd.(*Mirror).PackageName
+			}),
+		},
+		{
+			Name:        "version",
+			Description: "只复制满足版本约束的版本,如>=2.0、2.*.",
+			TrySetValue: pkg.TrySetStringValue("version", func(cmd pkg.Command) *string {
+				return &cmd.(*Mirror).Version
+			}),
+		},
+		{
+			Name:        "parallel",
+			Description: fmt.Sprintf("同时复制的模块数量,默认为%d.", _defaultParallel),
+			TrySetValue: pkg.TrySetIntValue("parallel", func(cmd pkg.Command) *int {
+				return &cmd.(*Mirror).Parallel
+			}),
+		},
+		{
+			Name:        "report",
+			Description: "json格式的复制报告保存路径.",
+			TrySetValue: pkg.TrySetPathValue("report", func(cmd pkg.Command) *string {
+				return &cmd.(*Mirror).Report
+			}),
+		},
+		{
+			Name:        "dry-run",
+			Description: "只列出将要复制的版本,不执行复制.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("dry-run", func(cmd pkg.Command) *bool {
+				return &cmd.(*Mirror).DryRun
+			}),
+		},
+	}
+}
+
+func (m *Mirror) Run() int {
+	if len(m.From) <= 0 || len(m.To) <= 0 {
+		fmt.Fprintln(os.Stderr, "必须通过--from与--to指定源feed与目标feed")
+		return 2
+	}
+	constraint, err := pkg.ParseVersionConstraint(m.Version)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, err = path.Match(m.PackageName, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "无效的名称: %s\n", m.PackageName)
+		return 2
+	}
+	if m.Parallel <= 0 {
+		m.Parallel = _defaultParallel
+	}
+
+	from, err := resolveFeedClient(m.From, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	to, err := resolveFeedClient(m.To, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if strings.EqualFold(strings.TrimRight(from.FeedURL, "/"), strings.TrimRight(to.FeedURL, "/")) {
+		fmt.Fprintln(os.Stderr, "源feed与目标feed不能相同")
+		return 2
+	}
+
+	ctx := context.Background()
+	report := &mirrorReport{From: from.FeedURL, To: to.FeedURL, Started: time.Now()}
+	report.Packages, err = m.listVersions(ctx, from, constraint)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(report.Packages) <= 0 {
+		fmt.Println("没有需要复制的模块")
+	}
+
+	tempDirectory, err := os.MkdirTemp("", "upack-mirror")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	var mu sync.Mutex
+	parallelForEach(len(report.Packages), m.Parallel, func(index int) {
+		p := report.Packages[index]
+		m.mirrorVersion(ctx, from, to, p, filepath.Join(tempDirectory, fmt.Sprintf("%d.upack", index)))
+		mu.Lock()
+		defer mu.Unlock()
+		switch p.Status {
+		case MirrorCopied:
+			report.Copied++
+			fmt.Println(groupAndName(p.Group, p.Name), p.Version, "copied")
+		case MirrorSkipped:
+			report.Skipped++
+		case MirrorFailed:
+			report.Failed++
+			fmt.Fprintf(os.Stderr, "复制%s@%s失败: %s\n", groupAndName(p.Group, p.Name), p.Version, p.Reason)
+		}
+	})
+	report.Finished = time.Now()
+
+	printMirrorReport(report, m.DryRun)
+	if len(m.Report) > 0 {
+		err = writeMirrorReport(m.Report, report)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// 列出源feed中满足过滤条件的所有版本
+func (m *Mirror) listVersions(ctx context.Context, from *pkg.FeedClient, constraint *pkg.VersionConstraint) ([]*mirrorPackage, error) {
+	packages, err := from.ListPackages(ctx, m.Group)
+	if err != nil {
+		return nil, err
+	}
+	var result []*mirrorPackage
+	for _, p := range packages {
+		if len(m.Group) > 0 && !strings.EqualFold(p.Group, m.Group) {
+			continue
+		}
+		if len(m.PackageName) > 0 {
+			if matched, _ := path.Match(strings.ToLower(m.PackageName), strings.ToLower(p.Name)); !matched {
+				continue
+			}
+		}
+		versions, err := from.ListVersions(ctx, p.Group, p.Name)
+		if err != nil {
+			return nil, fmt.Errorf("读取%s的版本失败: %v", p.GroupAndName(), err)
+		}
+		sortRemoteVersionsDescending(versions)
+		for _, v := range versions {
+			version, err := pkg.ParseUniversalPackageVersion(v.Version)
+			if err != nil || !constraint.Check(version) {
+				continue
+			}
+			result = append(result, &mirrorPackage{
+				Group:   p.Group,
+				Name:    p.Name,
+				Version: version.String(),
+				SHA1:    strings.ToLower(v.SHA1),
+				Size:    v.Size,
+				Status:  MirrorPending,
+			})
+		}
+	}
+	return result, nil
+}
+
+// 复制一个版本,目标中已存在且哈希值相同时跳过,哈希值不同时不覆盖
+func (m *Mirror) mirrorVersion(ctx context.Context, from, to *pkg.FeedClient, p *mirrorPackage, tempPath string) {
+	existing, err := to.GetVersion(ctx, p.Group, p.Name, p.Version)
+	switch {
+	case err == nil && len(p.SHA1) > 0 && strings.EqualFold(existing.SHA1, p.SHA1):
+		p.Status, p.Reason = MirrorSkipped, "sha1 matches"
+		return
+	case err == nil:
+		p.Status, p.Reason = MirrorFailed, fmt.Sprintf("目标中已存在哈希值不同的版本(sha1: %s)", existing.SHA1)
+		return
+	case !pkg.IsNotFound(err):
+		p.Status, p.Reason = MirrorFailed, err.Error()
+		return
+	}
+	if m.DryRun {
+		return
+	}
+
+	defer os.Remove(tempPath)
+	//下载时会校验源feed提供的哈希值
+	err = downloadPackageToFile(ctx, from, p.Group, p.Name, p.Version, tempPath)
+	if err == nil {
+		p.SHA1, err = pkg.GetSHA1(tempPath)
+	}
+	if err == nil {
+		err = uploadPackageFile(ctx, to, tempPath)
+	}
+	if err != nil {
+		p.Status, p.Reason = MirrorFailed, err.Error()
+		return
+	}
+
+	remoteHash, err := getRemotePackageSHA1(ctx, to, p.Group, p.Name, p.Version)
+	if err != nil {
+		p.Status, p.Reason = MirrorFailed, "校验失败: "+err.Error()
+		return
+	}
+	if !strings.EqualFold(remoteHash, p.SHA1) {
+		p.Status, p.Reason = MirrorFailed, fmt.Sprintf("哈希值不一致: 本地%s,远程%s", p.SHA1, remoteHash)
+		return
+	}
+	p.Status = MirrorCopied
+}
+
+func printMirrorReport(report *mirrorReport, dryRun bool) {
+	if dryRun {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PACKAGE\tVERSION\tACTION")
+		for _, p := range report.Packages {
+			action := "copy"
+			if p.Status != MirrorPending {
+				action = p.Status
+				if len(p.Reason) > 0 {
+					action += " (" + p.Reason + ")"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", groupAndName(p.Group, p.Name), p.Version, action)
+		}
+		_ = w.Flush()
+	}
+	fmt.Printf("%s -> %s: %d copied, %d skipped, %d failed, elapsed time:%.0f seconds\n",
+		report.From, report.To, report.Copied, report.Skipped, report.Failed, report.Finished.Sub(report.Started).Seconds())
+}
+
+func writeMirrorReport(reportPath string, report *mirrorReport) error {
+	sort.SliceStable(report.Packages, func(a, b int) bool {
+		return strings.ToLower(groupAndName(report.Packages[a].Group, report.Packages[a].Name)) <
+			strings.ToLower(groupAndName(report.Packages[b].Group, report.Packages[b].Name))
+	})
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0644)
+}
+
+// 解析feed参数:可以是feed名称、feed地址(http://proget/upack/feed/)或本地目录,
+// create为true时本地目录不存在则创建
+func resolveFeedClient(value string, create bool) (*pkg.FeedClient, error) {
+	configuration := defaultConfiguration()
+	if !strings.Contains(value, "://") && !strings.ContainsAny(value, `/\`) && !strings.HasPrefix(value, ".") {
+		configuration.SetSourceFeedName(value)
+		if len(configuration.SourceFeedUrl) <= 0 {
+			return nil, fmt.Errorf("未配置模块仓储地址,无法访问feed %s", value)
+		}
+		return configuration.FeedClient(), nil
+	}
+
+	if root, ok := pkg.DirectoryFeedRoot(value); ok {
+		if create {
+			if err := os.MkdirAll(root, 0755); err != nil {
+				return nil, err
+			}
+		} else if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("目录%s不存在", root)
+		}
+		return pkg.NewFeedClient(root, nil), nil
+	}
+
+	//只向配置的模块仓储发送配置中的认证信息,其它地址使用凭据文件中对应的凭据
+	auth := pkg.AuthOptions{}
+	if pkg.IsFeedURL(configuration.SourceUrl, value) {
+		auth = withAuthentication(configuration.Auth, configuration.Authentication)
+	}
+	return configuration.newFeedClient(value, auth), nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 在本地目录feed中写入 组/名称-版本.upack,返回模块包的sha1
+func writeTestPackage(t *testing.T, root, group, name, version, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("upack.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.NewEncoder(w).Encode(map[string]string{"group": group, "name": name, "version": version}); err != nil {
+		t.Fatal(err)
+	}
+	if w, err = zw.Create("package/readme.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fileName := filepath.Join(root, filepath.FromSlash(group), name+"-"+version+".upack")
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+func readMirrorReport(t *testing.T, reportPath string) map[string]*mirrorPackage {
+	t.Helper()
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report mirrorReport
+	if err = json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	packages := make(map[string]*mirrorPackage)
+	for _, p := range report.Packages {
+		packages[p.Name] = p
+	}
+	return packages
+}
+
+func TestMirrorDirectoryToDirectory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	from, to := t.TempDir(), t.TempDir()
+	report := filepath.Join(t.TempDir(), "report.json")
+	sha1A := writeTestPackage(t, from, "g", "a", "1.0.0", "a")
+	sha1B := writeTestPackage(t, from, "g", "b", "1.0.0", "b")
+
+	m := &Mirror{From: from, To: to, Parallel: 2, Report: report}
+	if exitCode := m.Run(); exitCode != 0 {
+		t.Fatalf("mirror exit code = %d", exitCode)
+	}
+	for name, sha1 := range map[string]string{"a": sha1A, "b": sha1B} {
+		p := readMirrorReport(t, report)[name]
+		if p == nil || p.Status != MirrorCopied || p.SHA1 != sha1 {
+			t.Errorf("%s: first mirror = %+v, want copied with sha1 %s", name, p, sha1)
+		}
+	}
+
+	//目标中已存在且哈希值相同的版本跳过
+	if exitCode := m.Run(); exitCode != 0 {
+		t.Fatalf("second mirror exit code = %d", exitCode)
+	}
+	for name, p := range readMirrorReport(t, report) {
+		if p.Status != MirrorSkipped {
+			t.Errorf("%s: second mirror status = %s (%s), want skipped", name, p.Status, p.Reason)
+		}
+	}
+}
+
+func TestMirrorDirectorySHA1Mismatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	from, to := t.TempDir(), t.TempDir()
+	report := filepath.Join(t.TempDir(), "report.json")
+	writeTestPackage(t, from, "g", "a", "1.0.0", "a")
+	writeTestPackage(t, from, "g", "b", "1.0.0", "b")
+	sha1A := writeTestPackage(t, to, "g", "a", "1.0.0", "changed")
+
+	m := &Mirror{From: from, To: to, Parallel: 1, Report: report}
+	if exitCode := m.Run(); exitCode == 0 {
+		t.Fatal("mirror should fail when the target has a version with a different sha1")
+	}
+	packages := readMirrorReport(t, report)
+	if p := packages["a"]; p == nil || p.Status != MirrorFailed {
+		t.Errorf("a: status = %+v, want failed", p)
+	}
+	if p := packages["b"]; p == nil || p.Status != MirrorCopied {
+		t.Errorf("b: status = %+v, want copied", p)
+	}
+
+	//目标中的版本不应被覆盖
+	data, err := os.ReadFile(filepath.Join(to, "g", "a-1.0.0.upack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha1.Sum(data); hex.EncodeToString(sum[:]) != sha1A {
+		t.Error("mirror overwrote the target version")
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// --output支持的输出格式
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// 检查--output参数,为空时使用text
+func parseOutputFormat(output string) (string, error) {
+	switch strings.ToLower(output) {
+	case "", OutputText:
+		return OutputText, nil
+	case OutputJSON:
+		return OutputJSON, nil
+	}
+	return "", fmt.Errorf("无效的输出格式: %s,只支持text或json", output)
+}
+
+// 以缩进的json格式输出到标准输出
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -61,8 +62,8 @@ func parseGroupAndName(packageName string) *packageInfo {
 }
 
 // find latest version in source feed
-func getLatestVersion(source, group, name, version string, credentials *[2]string, prerelease bool) (latestVersion *pkg.UniversalPackageVersion, err error) {
-	versionString, err := pkg.GetVersion(source, group, name, version, credentials, prerelease)
+func getLatestVersion(feed *pkg.FeedClient, group, name, version string, prerelease bool) (latestVersion *pkg.UniversalPackageVersion, err error) {
+	versionString, err := feed.GetLatestVersion(context.Background(), group, name, version, prerelease)
 	if err != nil {
 		return nil, err
 	}
@@ -72,3 +73,36 @@ func getLatestVersion(source, group, name, version string, credentials *[2]strin
 	}
 	return latestVersion, nil
 }
+
+// 查找注册表中同名模块除当前版本外的最高版本,未安装过时返回空字符串
+func findPreviousVersion(r pkg.Registry, group, name string, version *pkg.UniversalPackageVersion) string {
+	packages, err := r.ListInstalledPackages()
+	if err != nil {
+		return ""
+	}
+	var previous *pkg.UniversalPackageVersion
+	for _, installed := range packages {
+		if !strings.EqualFold(installed.Group, group) || !strings.EqualFold(installed.Name, name) {
+			continue
+		}
+		if installed.Version == nil || installed.Version.Equals(version) {
+			continue
+		}
+		if previous == nil || previous.Compare(installed.Version) < 0 {
+			previous = installed.Version
+		}
+	}
+	if previous == nil {
+		return ""
+	}
+	return previous.String()
+}
+
+// previous为空或者不低于version时不是升级,如重新安装同一版本或者安装较低的版本
+func isUpgrade(previous string, version *pkg.UniversalPackageVersion) bool {
+	if len(previous) <= 0 || version == nil {
+		return false
+	}
+	previousVersion, err := pkg.ParseUniversalPackageVersion(previous)
+	return err == nil && previousVersion.Compare(version) < 0
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+func TestIsUpgrade(t *testing.T) {
+	for _, test := range []struct {
+		previous, version string
+		upgrade           bool
+	}{
+		{"", "1.0.0", false},
+		{"1.0.0", "1.1.0", true},
+		{"1.1.0", "1.0.0", false},
+		{"1.0.0", "1.0.0", false},
+		{"1.0.0-beta", "1.0.0", true},
+		{"1.0.0", "1.0.0-beta", false},
+		{"invalid", "1.0.0", false},
+	} {
+		version, err := pkg.ParseUniversalPackageVersion(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if upgrade := isUpgrade(test.previous, version); upgrade != test.upgrade {
+			t.Errorf("isUpgrade(%q, %s) = %v, want %v", test.previous, test.version, upgrade, test.upgrade)
+		}
+	}
+}
@@ -83,11 +83,11 @@ func (p *PackApp) setupDefaultProperties() {
 		p.Metadata.SetName(filepath.Base(p.SourceDirectory))
 	}
 	if len(p.Metadata.Version()) <= 0 {
-		latestVersion, err := getLatestVersion(p._configuration.SourceFeedUrl,
+		latestVersion, err := getLatestVersion(p._configuration.FeedClient(),
 			p.Metadata.Group(),
 			p.Metadata.Name(),
 			"",
-			p._configuration.Authentication, false)
+			false)
 		if err == nil {
 			latestVersion.Minor.SetInt64(latestVersion.Minor.Int64() + 1)
 			p.Metadata.SetVersion(latestVersion.String())
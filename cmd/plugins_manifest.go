@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 模块清单文件,描述一个部署环境需要安装的全部模块,支持json与yaml格式:
+//
+//	{
+//	  "packages": [
+//	    { "package": "plugins/quartz", "version": ">=2.2 <3" },
+//	    { "package": "plugins/report", "version": "1.4.0", "feed": "plugins-test", "target": "custom/report" }
+//	  ]
+//	}
+type PluginsManifest struct {
+	Packages []PluginsManifestEntry `json:"packages" yaml:"packages"`
+}
+
+type PluginsManifestEntry struct {
+	//模块所属组与名称,如plugins/quartz,也可以使用plugins/quartz@2.*的形式同时指定版本
+	Package string `json:"package" yaml:"package"`
+	//版本或版本约束,为空时安装最新版本
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	//模块仓储feed名称,为空时使用默认配置
+	Feed string `json:"feed,omitempty" yaml:"feed,omitempty"`
+	//安装目录,为空时安装到插件目录,相对路径相对于清单文件所在的目录
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+}
+
+// 获取<模块组/模块名@版本>格式的名称
+func (e PluginsManifestEntry) PackageName() string {
+	if len(e.Version) <= 0 || strings.Contains(e.Package, "@") {
+		return e.Package
+	}
+	return e.Package + "@" + e.Version
+}
+
+// 读取模块清单文件,根据扩展名决定使用yaml还是json格式
+func readPluginsManifest(filename string) (*PluginsManifest, error) {
+	data, err := readJsonFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &PluginsManifest{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, manifest)
+	default:
+		err = json.Unmarshal(data, manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无效的模块清单文件%s: %v", filename, err)
+	}
+
+	for index, entry := range manifest.Packages {
+		if len(strings.TrimSpace(entry.Package)) <= 0 {
+			return nil, fmt.Errorf("无效的模块清单文件%s: 第%d项缺少package", filename, index+1)
+		}
+		if len(entry.Target) > 0 && !filepath.IsAbs(entry.Target) {
+			manifest.Packages[index].Target = filepath.Join(filepath.Dir(filename), entry.Target)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+type Promote struct {
+	//模块所属组、名称、版本的组合名称,如plugins/quartz@2.2.0-rc.1
+	PackageName string
+	//源feed名称
+	From string
+	//目标feed名称
+	To string
+	//重新打包,在upack.json中追加审计记录
+	Repack bool
+	//重新打包并去掉版本号中的预发布标签,如2.2.0-rc.1发布为2.2.0
+	Release bool
+	//审计记录中的说明
+	Note string
+
+	_fromConfiguration Configuration
+	_toConfiguration   Configuration
+}
+
+func (*Promote) Name() string { return "promote" }
+func (*Promote) Description() string {
+	return "将模块从一个feed复制到另一个feed,如从测试feed发布到生产feed."
+}
+
+func (p *Promote) Help() string  { return pkg.DefaultCommandHelp(p) }
+func (p *Promote) Usage() string { return pkg.DefaultCommandUsage(p) }
+
+func (*Promote) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "package",
+			Description: "模块所属组、名称、版本的组合名称,格式使用: 所属组/名称@版本,如plugins/quartz@2.2.0-rc.1,所属组为空时使用配置中的默认组.",
+			Index:       0,
+			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
+				return &cmd.(*Promote).PackageName
+			}),
+		},
+	}
+}
+
+func (*Promote) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "from",
+			Description: "源feed名称.",
+			TrySetValue: pkg.TrySetStringValue("from", func(cmd pkg.Command) *string {
+				return &cmd.(*Promote).From
+			}),
+		},
+		{
+			Name:        "to",
+			Description: "目标feed名称.",
+			TrySetValue: pkg.TrySetStringValue("to", func(cmd pkg.Command) *string {
+				return &cmd.(*Promote).To
+			}),
+		},
+		{
+			Name:        "repack",
+			Description: "重新打包,在upack.json的repackageHistory中追加审计记录.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("repack", func(cmd pkg.Command) *bool {
+				return &cmd.(*Promote).Repack
+			}),
+		},
+		{
+			Name:        "release",
+			Description: "重新打包并去掉版本号中的预发布标签,如2.2.0-rc.1发布为2.2.0.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("release", func(cmd pkg.Command) *bool {
+				return &cmd.(*Promote).Release
+			}),
+		},
+		{
+			Name:        "note",
+			Description: "重新打包时审计记录中的说明.",
+			TrySetValue: pkg.TrySetStringValue("note", func(cmd pkg.Command) *string {
+				return &cmd.(*Promote).Note
+			}),
+		},
+	}
+}
+
+func (p *Promote) Run() int {
+	if len(p.From) <= 0 || len(p.To) <= 0 {
+		fmt.Fprintln(os.Stderr, "必须通过--from与--to指定源feed与目标feed")
+		return 2
+	}
+	if strings.EqualFold(p.From, p.To) {
+		fmt.Fprintln(os.Stderr, "源feed与目标feed不能相同")
+		return 2
+	}
+	if len(p.Note) > 0 && !p.Repack && !p.Release {
+		fmt.Fprintln(os.Stderr, "--note只能与--repack或--release一起使用")
+		return 2
+	}
+	info, err := parsePackageNameWithVersion(p.PackageName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !pkg.IsExactVersion(info.version) {
+		fmt.Fprintln(os.Stderr, "必须指定要复制的精确版本,如plugins/quartz@2.2.0-rc.1")
+		return 2
+	}
+
+	p._fromConfiguration = defaultConfigurationWithFeedName(p.From)
+	p._toConfiguration = defaultConfigurationWithFeedName(p.To)
+	if len(info.group) <= 0 {
+		info.group = p._fromConfiguration.DefaultGroup
+	}
+
+	err = p.promote(context.Background(), info)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func (p *Promote) promote(ctx context.Context, info *packageInfo) error {
+	version, err := pkg.ParseUniversalPackageVersion(strings.TrimPrefix(info.version, "="))
+	if err != nil {
+		return err
+	}
+	targetVersion := version
+	if p.Release {
+		targetVersion = pkg.NewUniversalPackageVersion(&version.Major, &version.Minor, &version.Patch, "", "")
+	}
+	packageName := groupAndName(info.group, info.name)
+
+	fromFeed := p._fromConfiguration.FeedClient()
+	toFeed := p._toConfiguration.FeedClient()
+
+	existing, err := toFeed.GetVersion(ctx, info.group, info.name, targetVersion.String())
+	if err == nil {
+		return fmt.Errorf("%s中已存在%s@%s(sha1: %s)", p.To, packageName, targetVersion, existing.SHA1)
+	} else if !pkg.IsNotFound(err) {
+		return err
+	}
+
+	tempDirectory, err := os.MkdirTemp("", "upack-promote")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	//下载时会校验源feed提供的哈希值
+	fmt.Println("downloading", packageName+"@"+version.String(), "from", p.From, "please waitting...")
+	packagePath := filepath.Join(tempDirectory, info.name+"-"+version.String()+".upack")
+	err = downloadPackageToFile(ctx, fromFeed, info.group, info.name, version.String(), packagePath)
+	if err != nil {
+		return err
+	}
+
+	if p.Repack || p.Release {
+		repack := &pkg.Repack{
+			SourcePath:      packagePath,
+			TargetDirectory: filepath.Join(tempDirectory, "repack"),
+			Note:            p.Note,
+			Overwrite:       true,
+		}
+		if len(p.Note) <= 0 {
+			repack.Note = fmt.Sprintf("promoted from %s to %s", p.From, p.To)
+		}
+		repack.Metadata.SetVersion(targetVersion.String())
+		packagePath, err = repack.Repackage()
+		if err != nil {
+			return err
+		}
+	}
+
+	hash, err := pkg.GetSHA1(packagePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("uploading", packageName+"@"+targetVersion.String(), "to", p.To, "please waitting...")
+	err = uploadPackageFile(ctx, toFeed, packagePath)
+	if err != nil {
+		return err
+	}
+
+	remoteHash, err := getRemotePackageSHA1(ctx, toFeed, info.group, info.name, targetVersion.String())
+	if err != nil {
+		return fmt.Errorf("校验%s中的%s@%s失败: %v", p.To, packageName, targetVersion, err)
+	}
+	if !strings.EqualFold(hash, remoteHash) {
+		return fmt.Errorf("%s中的%s@%s哈希值不一致: 本地%s,远程%s", p.To, packageName, targetVersion, hash, remoteHash)
+	}
+
+	fmt.Println(packageName, targetVersion.String(), "promoted from", p.From, "to", p.To, "(sha1:", hash+")")
+	return nil
+}
+
+func downloadPackageToFile(ctx context.Context, feed *pkg.FeedClient, group, name, version, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = feed.DownloadToFile(ctx, f, group, name, version)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func uploadPackageFile(ctx context.Context, feed *pkg.FeedClient, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return feed.Upload(ctx, io.NewSectionReader(f, 0, fi.Size()), fi.Size())
+}
+
+// 获取feed中模块包的sha1,feed未提供时下载模块包计算
+func getRemotePackageSHA1(ctx context.Context, feed *pkg.FeedClient, group, name, version string) (string, error) {
+	remote, err := feed.GetVersion(ctx, group, name, version)
+	if err != nil {
+		return "", err
+	}
+	if len(remote.SHA1) > 0 {
+		return remote.SHA1, nil
+	}
+
+	body, _, err := feed.Download(ctx, group, name, version)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	h := sha1.New()
+	_, err = io.Copy(h, body)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
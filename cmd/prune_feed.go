@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+const (
+	_defaultKeepStable     = 10
+	_defaultKeepPrerelease = 5
+)
+
+type PruneFeed struct {
+	//模块所属组与名称,如App/helloworld
+	PackageName    string
+	SourceFeedName string
+	//保留最新的N个正式版本,为空时使用默认值
+	KeepStable *int
+	//保留最新的M个预发布版本,为空时使用默认值
+	KeepPrerelease *int
+	//保留发布时间在该时长之内的版本,如30d、72h
+	KeepNewerThan string
+	//模块清单文件,其中指定了精确版本的模块不会被删除
+	Lockfile string
+	//执行删除,默认只列出将要删除的版本
+	Apply bool
+
+	_configuration Configuration
+}
+
+type pruneDecision struct {
+	Version   *pkg.RemotePackageVersion
+	Keep      bool
+	Reason    string
+	published time.Time
+}
+
+func (*PruneFeed) Name() string { return "prune-feed" }
+func (*PruneFeed) Description() string {
+	return "按照保留策略删除模块仓储中模块的旧版本,默认只列出将要删除的版本."
+}
+
+func (p *PruneFeed) Help() string  { return pkg.DefaultCommandHelp(p) }
+func (p *PruneFeed) Usage() string { return pkg.DefaultCommandUsage(p) }
+
+func (*PruneFeed) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "package",
+			Description: "模块所属组与名称,如App/helloworld,不包含所属组时使用配置中的默认组.",
+			Index:       0,
+			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
+				return &cmd.(*PruneFeed).PackageName
+			}),
+		},
+	}
+}
+
+func (*PruneFeed) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "feed",
+			Description: "模块仓储feed名称,为空时使用默认配置.",
+			TrySetValue: pkg.TrySetStringValue("feed", func(cmd pkg.Command) *string {
+				return &cmd.(*PruneFeed).SourceFeedName
+			}),
+		},
+		{
+			Name:        "keep",
+			Description: fmt.Sprintf("保留最新的N个正式版本,默认为%d.", _defaultKeepStable),
+			TrySetValue: trySetOptionalIntValue("keep", func(cmd pkg.Command) **int {
+				return &cmd.(*PruneFeed).KeepStable
+			}),
+		},
+		{
+			Name:        "keep-prerelease",
+			Description: fmt.Sprintf("保留最新的M个预发布版本,默认为%d.", _defaultKeepPrerelease),
+			TrySetValue: trySetOptionalIntValue("keep-prerelease", func(cmd pkg.Command) **int {
+				return &cmd.(*PruneFeed).KeepPrerelease
+			}),
+		},
+		{
+			Name:        "keep-newer-than",
+			Description: "保留发布时间在该时长之内的版本,如30d、2w、72h.",
+			TrySetValue: pkg.TrySetStringValue("keep-newer-than", func(cmd pkg.Command) *string {
+				return &cmd.(*PruneFeed).KeepNewerThan
+			}),
+		},
+		{
+			Name:        "lockfile",
+			Description: "模块清单文件(json或yaml),其中指定了精确版本的模块不会被删除.",
+			TrySetValue: pkg.TrySetPathValue("lockfile", func(cmd pkg.Command) *string {
+				return &cmd.(*PruneFeed).Lockfile
+			}),
+		},
+		{
+			Name:        "apply",
+			Description: "执行删除,默认只列出将要删除的版本.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("apply", func(cmd pkg.Command) *bool {
+				return &cmd.(*PruneFeed).Apply
+			}),
+		},
+	}
+}
+
+func (p *PruneFeed) Run() int {
+	if len(p.PackageName) <= 0 || strings.Contains(p.PackageName, "@") {
+		fmt.Fprintln(os.Stderr, "必须指定模块所属组与名称,如App/helloworld,不能包含版本")
+		return 2
+	}
+	keepNewerThan, err := parseAge(p.KeepNewerThan)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	keepStable, keepPrerelease := _defaultKeepStable, _defaultKeepPrerelease
+	if p.KeepStable != nil {
+		keepStable = *p.KeepStable
+	}
+	if p.KeepPrerelease != nil {
+		keepPrerelease = *p.KeepPrerelease
+	}
+	if keepStable < 0 || keepPrerelease < 0 {
+		fmt.Fprintln(os.Stderr, "--keep与--keep-prerelease不能小于0")
+		return 2
+	}
+
+	if len(p.SourceFeedName) > 0 {
+		p._configuration = defaultConfigurationWithFeedName(p.SourceFeedName)
+	} else {
+		p._configuration = *defaultConfiguration()
+	}
+	info := parseGroupAndName(p.PackageName)
+	if len(info.group) <= 0 {
+		info.group = p._configuration.DefaultGroup
+	}
+	packageName := groupAndName(info.group, info.name)
+
+	pinned, err := p.readPinnedVersions(info.group, info.name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	feed := p._configuration.FeedClient()
+	versions, err := feed.ListVersions(ctx, info.group, info.name)
+	if err != nil {
+		if pkg.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "模块仓储中不存在模块%s\n", packageName)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	policy := pruneFeedPolicy{
+		keepStable:        keepStable,
+		keepPrerelease:    keepPrerelease,
+		keepNewerThan:     keepNewerThan,
+		keepNewerThanText: p.KeepNewerThan,
+		pinned:            pinned,
+	}
+	decisions := policy.decide(versions, time.Now())
+	var deleting int
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tPUBLISHED\tACTION\tREASON")
+	for _, decision := range decisions {
+		action := "keep"
+		if !decision.Keep {
+			action = "delete"
+			deleting++
+		}
+		published := decision.Version.Published
+		if !decision.published.IsZero() {
+			published = decision.published.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", decision.Version.Version, published, action, decision.Reason)
+	}
+	_ = w.Flush()
+	fmt.Printf("%s: %d versions, %d to keep, %d to delete\n", packageName, len(decisions), len(decisions)-deleting, deleting)
+
+	if !p.Apply {
+		if deleting > 0 {
+			fmt.Println("dry run,指定--apply执行删除")
+		}
+		return 0
+	}
+
+	var failed int
+	for _, decision := range decisions {
+		if decision.Keep {
+			continue
+		}
+		err = feed.Delete(ctx, info.group, info.name, decision.Version.Version)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "删除%s@%s失败: %v\n", packageName, decision.Version.Version, err)
+			continue
+		}
+		fmt.Println(packageName, decision.Version.Version, "deleted!")
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+type pruneFeedPolicy struct {
+	keepStable     int
+	keepPrerelease int
+	keepNewerThan  time.Duration
+	//用于输出的原始时长,如30d
+	keepNewerThanText string
+	//lockfile中指定的版本
+	pinned map[string]bool
+}
+
+// 根据保留策略决定每个版本是否保留,结果按版本号从高到低排序
+func (p pruneFeedPolicy) decide(versions []*pkg.RemotePackageVersion, now time.Time) []*pruneDecision {
+	sortRemoteVersionsDescending(versions)
+
+	var stable, prerelease int
+	decisions := make([]*pruneDecision, 0, len(versions))
+	for _, v := range versions {
+		decision := &pruneDecision{Version: v}
+		decision.published, _ = v.PublishedDate()
+		decisions = append(decisions, decision)
+
+		parsed, err := pkg.ParseUniversalPackageVersion(v.Version)
+		switch {
+		case err != nil:
+			decision.Keep, decision.Reason = true, "invalid version"
+		case p.pinned[parsed.String()]:
+			decision.Keep, decision.Reason = true, "pinned in lockfile"
+		case parsed.Prerelease == "" && stable < p.keepStable:
+			decision.Keep, decision.Reason = true, fmt.Sprintf("newest %d stable", p.keepStable)
+		case parsed.Prerelease != "" && prerelease < p.keepPrerelease:
+			decision.Keep, decision.Reason = true, fmt.Sprintf("newest %d prerelease", p.keepPrerelease)
+		case p.keepNewerThan > 0 && decision.published.IsZero():
+			//无法确定发布时间时保留
+			decision.Keep, decision.Reason = true, "unknown publish date"
+		case p.keepNewerThan > 0 && now.Sub(decision.published) < p.keepNewerThan:
+			decision.Keep, decision.Reason = true, "newer than "+p.keepNewerThanText
+		}
+		if err == nil {
+			if parsed.Prerelease == "" {
+				stable++
+			} else {
+				prerelease++
+			}
+		}
+	}
+	return decisions
+}
+
+// 读取lockfile中指定模块的精确版本
+func (p *PruneFeed) readPinnedVersions(group, name string) (map[string]bool, error) {
+	pinned := make(map[string]bool)
+	if len(p.Lockfile) <= 0 {
+		return pinned, nil
+	}
+	manifest, err := readPluginsManifest(p.Lockfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Packages {
+		info, err := parsePackageNameWithVersion(entry.PackageName())
+		if err != nil {
+			return nil, err
+		}
+		if len(info.group) <= 0 {
+			info.group = p._configuration.DefaultGroup
+		}
+		if !strings.EqualFold(info.group, group) || !strings.EqualFold(info.name, name) || !pkg.IsExactVersion(info.version) {
+			continue
+		}
+		version, err := pkg.ParseUniversalPackageVersion(strings.TrimPrefix(strings.TrimSpace(info.version), "="))
+		if err != nil {
+			return nil, err
+		}
+		pinned[version.String()] = true
+	}
+	return pinned, nil
+}
+
+// 解析30d、2w、72h这样的时长,为空时返回0
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if len(s) <= 0 {
+		return 0, nil
+	}
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	if unit, ok := units[strings.ToLower(s[len(s)-1:])]; ok {
+		n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err == nil && n >= 0 {
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的时长: %s,可以使用30d、2w、72h这样的格式", s)
+	}
+	return d, nil
+}
+
+// 设置可选的整数参数,未指定时保持为nil
+func trySetOptionalIntValue(name string, f func(pkg.Command) **int) func(pkg.Command, *string) bool {
+	return func(cmd pkg.Command, value *string) bool {
+		var i int
+		if !pkg.TrySetIntValue(name, func(pkg.Command) *int { return &i })(cmd, value) {
+			return false
+		}
+		*f(cmd) = &i
+		return true
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+func TestPruneFeedPolicyDecide(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// 版本与发布于多少天前,为负数时没有发布时间
+	versions := []struct {
+		version string
+		age     int
+	}{
+		{"1.0.0", 100}, {"1.1.0", 90}, {"1.2.0-beta", 80}, {"1.2.0", 70}, {"2.0.0-alpha", 20},
+		{"2.0.0-beta", 10}, {"2.0.0", 5}, {"0.9.0", -1}, {"bad", 200},
+	}
+	for _, test := range []struct {
+		name   string
+		policy pruneFeedPolicy
+		// 保留的版本与原因中包含的文字
+		keep map[string]string
+	}{
+		{
+			name:   "keep last N",
+			policy: pruneFeedPolicy{keepStable: 2, keepPrerelease: 1},
+			keep:   map[string]string{"2.0.0": "newest 2 stable", "1.2.0": "newest 2 stable", "2.0.0-beta": "newest 1 prerelease", "bad": "invalid version"},
+		},
+		{
+			name:   "keep nothing",
+			policy: pruneFeedPolicy{},
+			keep:   map[string]string{"bad": "invalid version"},
+		},
+		{
+			name:   "max age",
+			policy: pruneFeedPolicy{keepStable: 1, keepNewerThan: 30 * day, keepNewerThanText: "30d"},
+			keep:   map[string]string{"2.0.0": "newest 1 stable", "2.0.0-beta": "newer than 30d", "2.0.0-alpha": "newer than 30d", "0.9.0": "unknown publish date", "bad": "invalid version"},
+		},
+		{
+			name:   "max age keeps prerelease beyond count",
+			policy: pruneFeedPolicy{keepPrerelease: 1, keepNewerThan: 85 * day, keepNewerThanText: "85d"},
+			keep:   map[string]string{"2.0.0": "newer than", "1.2.0": "newer than", "2.0.0-beta": "newest 1 prerelease", "2.0.0-alpha": "newer than", "1.2.0-beta": "newer than", "0.9.0": "unknown publish date", "bad": "invalid version"},
+		},
+		{
+			name:   "pinned",
+			policy: pruneFeedPolicy{keepStable: 1, pinned: map[string]bool{"1.0.0": true, "1.2.0-beta": true}},
+			keep:   map[string]string{"2.0.0": "newest 1 stable", "1.0.0": "pinned", "1.2.0-beta": "pinned", "bad": "invalid version"},
+		},
+	} {
+		var remote []*pkg.RemotePackageVersion
+		for _, v := range versions {
+			version := &pkg.RemotePackageVersion{Version: v.version}
+			if v.age >= 0 {
+				version.Published = now.Add(-time.Duration(v.age) * day).Format(time.RFC3339)
+			}
+			remote = append(remote, version)
+		}
+		decisions := test.policy.decide(remote, now)
+		if len(decisions) != len(versions) {
+			t.Fatalf("%s: %d decisions for %d versions", test.name, len(decisions), len(versions))
+		}
+		var order []string
+		for _, decision := range decisions {
+			order = append(order, decision.Version.Version)
+			reason, keep := test.keep[decision.Version.Version]
+			if decision.Keep != keep {
+				t.Errorf("%s: %s keep = %v (%s), want %v", test.name, decision.Version.Version, decision.Keep, decision.Reason, keep)
+				continue
+			}
+			if keep && !strings.Contains(decision.Reason, reason) {
+				t.Errorf("%s: %s reason = %q, want %q", test.name, decision.Version.Version, decision.Reason, reason)
+			}
+		}
+		if got := strings.Join(order[:7], " "); got != "2.0.0 2.0.0-beta 2.0.0-alpha 1.2.0 1.2.0-beta 1.1.0 1.0.0" {
+			t.Errorf("%s: decisions are not sorted by version: %s", test.name, strings.Join(order, " "))
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for _, test := range []struct {
+		age string
+		d   time.Duration
+		err bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1.5D", 36 * time.Hour, false},
+		{"72h", 72 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"-1d", 0, true},
+		{"-2h", 0, true},
+		{"abc", 0, true},
+	} {
+		d, err := parseAge(test.age)
+		if (err != nil) != test.err || d != test.d {
+			t.Errorf("parseAge(%q) = %s, %v", test.age, d, err)
+		}
+	}
+}
@@ -2,26 +2,51 @@ package cmd
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
-	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/shanluzhineng/upack/pkg"
 )
 
+// feed中已存在相同版本时的处理方式
+const (
+	PushIfExistsFail      = "fail"
+	PushIfExistsSkip      = "skip"
+	PushIfExistsOverwrite = "overwrite"
+)
+
+// 上传结果
+const (
+	PushPublished = "published"
+	PushSkipped   = "skipped"
+	PushFailed    = "failed"
+)
+
 type Push struct {
+	//.upack文件路径,也可以是目录或通配符,上传其中所有的.upack文件
 	Package string
 
 	SourceFeedName string
 	Type           PackageType
+	//上传进度的输出方式: bar、quiet、json
+	Progress string
+	//上传前检查feed中是否已存在相同版本: fail、skip、overwrite,为空时不检查
+	IfExists string
+	//上传后不校验feed中模块包的sha1
+	NoVerify bool
+	//同时上传的模块数量
+	Parallel int
 
 	_configuration Configuration
 }
 
 func (*Push) Name() string { return "push" }
 func (*Push) Description() string {
-	return "发布一个模块包.upack文件到模块仓储中."
+	return "发布模块包.upack文件到模块仓储中,可以指定目录或通配符同时发布多个模块包."
 }
 
 func (p *Push) Help() string  { return pkg.DefaultCommandHelp(p) }
@@ -31,7 +56,7 @@ func (*Push) PositionalArguments() []pkg.PositionalArgument {
 	return []pkg.PositionalArgument{
 		{
 			Name:        "package",
-			Description: ".upack文件路径.",
+			Description: ".upack文件路径,也可以是目录或通配符(如dist/*.upack),上传其中所有的.upack文件.",
 			Index:       0,
 			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
 				return &cmd.(*Push).Package
@@ -41,7 +66,37 @@ func (*Push) PositionalArguments() []pkg.PositionalArgument {
 }
 
 func (*Push) ExtraArguments() []pkg.ExtraArgument {
-	return nil
+	return []pkg.ExtraArgument{
+		{
+			Name:        "progress",
+			Description: "上传进度的输出方式: bar(默认)、quiet、json.",
+			TrySetValue: pkg.TrySetStringValue("progress", func(cmd pkg.Command) *string {
+				return &cmd.(*Push).Progress
+			}),
+		},
+		{
+			Name:        "if-exists",
+			Description: "上传前检查feed中是否已存在相同版本,存在时fail: 失败、skip: sha1相同时跳过、不同时失败,overwrite: 先删除feed中的版本再上传(sha1相同时跳过),上传失败时该版本不会恢复.",
+			TrySetValue: pkg.TrySetStringValue("if-exists", func(cmd pkg.Command) *string {
+				return &cmd.(*Push).IfExists
+			}),
+		},
+		{
+			Name:        "no-verify",
+			Description: "上传后不校验feed中模块包的sha1.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("no-verify", func(cmd pkg.Command) *bool {
+				return &cmd.(*Push).NoVerify
+			}),
+		},
+		{
+			Name:        "parallel",
+			Description: fmt.Sprintf("同时上传的模块数量,默认为%d.", _defaultParallel),
+			TrySetValue: pkg.TrySetIntValue("parallel", func(cmd pkg.Command) *int {
+				return &cmd.(*Push).Parallel
+			}),
+		},
+	}
 }
 
 // 设置默认属性
@@ -59,86 +114,289 @@ func (i *Push) setupDefaultProperties() {
 	}
 }
 
+// 待上传的模块包
+type pushPackage struct {
+	path   string
+	info   *pkg.UniversalPackageMetadata
+	size   int64
+	sha1   string
+	status string
+	detail string
+}
+
 func (p *Push) Run() int {
 	p.setupDefaultProperties()
+	p.IfExists = strings.ToLower(p.IfExists)
+	switch p.IfExists {
+	case "", PushIfExistsFail, PushIfExistsSkip, PushIfExistsOverwrite:
+	default:
+		fmt.Fprintf(os.Stderr, "无效的--if-exists: %s,可选值为fail、skip、overwrite\n", p.IfExists)
+		return 2
+	}
+	if p.Parallel <= 0 {
+		p.Parallel = _defaultParallel
+	}
 
-	packageStream, err := os.Open(p.Package)
+	paths, err := expandPushPaths(p.Package)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
-	defer packageStream.Close()
+	if len(paths) <= 0 {
+		fmt.Fprintln(os.Stderr, "没有找到.upack文件:", p.Package)
+		return 2
+	}
+	multiple := len(paths) > 1
+	progress, err := newProgressReporter(p.Progress, multiple)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
 
-	var info *pkg.UniversalPackageMetadata
+	//上传前读取并校验所有模块包,任何一个无效时都不上传
+	packages := make([]*pushPackage, 0, len(paths))
+	exitCode := 0
+	seen := make(map[string]string)
+	for _, path := range paths {
+		pp, code, err := readPushPackage(path)
+		if err != nil {
+			if multiple {
+				fmt.Fprintf(os.Stderr, "%s: ", path)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			if code > exitCode {
+				exitCode = code
+			}
+			continue
+		}
+		key := strings.ToLower(pp.info.GroupAndName() + "@" + pp.info.Version())
+		if previous, ok := seen[key]; ok {
+			fmt.Fprintf(os.Stderr, "%s与%s是同一个版本: %s %s\n", path, previous, pp.info.GroupAndName(), pp.info.Version())
+			exitCode = 2
+			continue
+		}
+		seen[key] = path
+		packages = append(packages, pp)
+	}
+	if exitCode != 0 {
+		if multiple {
+			fmt.Fprintln(os.Stderr, "存在无效的模块包,没有上传任何模块包")
+		}
+		return exitCode
+	}
+
+	if !multiple {
+		w := summaryWriter(progress)
+		fmt.Fprintln(w, "Package:", packages[0].info.GroupAndName())
+		fmt.Fprintln(w, "Version:", packages[0].info.Version())
+	}
+	ctx := context.Background()
+	feed := p._configuration.FeedClient()
+	feed.Progress = progress
+	parallelForEach(len(packages), p.Parallel, func(index int) {
+		p.pushPackage(ctx, feed, packages[index])
+	})
+
+	failed := 0
+	for _, pp := range packages {
+		if pp.status == PushFailed {
+			failed++
+		}
+	}
+	if multiple {
+		printPushSummary(progress, packages)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// 展开package参数:可以是.upack文件、目录(其中所有的.upack文件,不包括子目录)或通配符
+func expandPushPaths(value string) ([]string, error) {
+	fi, err := os.Stat(value)
+	if err == nil && !fi.IsDir() {
+		return []string{value}, nil
+	}
+
+	var candidates []string
+	if err == nil {
+		entries, err := os.ReadDir(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			candidates = append(candidates, filepath.Join(value, entry.Name()))
+		}
+	} else if strings.ContainsAny(value, "*?[") {
+		candidates, err = filepath.Glob(value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的通配符%s: %v", value, err)
+		}
+	} else {
+		return nil, err
+	}
+
+	var paths []string
+	for _, candidate := range candidates {
+		if !strings.EqualFold(filepath.Ext(candidate), ".upack") {
+			continue
+		}
+		if fi, err := os.Stat(candidate); err == nil && fi.Mode().IsRegular() {
+			paths = append(paths, candidate)
+		}
+	}
+	return paths, nil
+}
+
+// 读取并校验模块包中的upack.json,返回的int为出错时的退出码
+func readPushPackage(path string) (*pushPackage, int, error) {
+	packageStream, err := os.Open(path)
+	if err != nil {
+		return nil, 1, err
+	}
+	defer packageStream.Close()
 
 	fi, err := packageStream.Stat()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return nil, 1, err
 	}
 
 	zipFile, err := zip.NewReader(packageStream, fi.Size())
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return nil, 1, err
 	}
 
+	var info *pkg.UniversalPackageMetadata
 	for _, entry := range zipFile.File {
 		if entry.Name == "upack.json" {
 			r, err := entry.Open()
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return 1
+				return nil, 1, err
 			}
 
 			info, err = pkg.ReadManifest(r)
+			_ = r.Close()
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return 1
+				return nil, 1, err
 			}
 			break
 		}
 	}
 
 	if info == nil {
-		fmt.Fprintln(os.Stderr, "upack.json missing from upack file!")
-		return 1
+		return nil, 1, fmt.Errorf("upack.json missing from upack file!")
 	}
 
 	err = pkg.ValidateManifest(info)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Invalid upack.json:", err)
-		return 2
+		return nil, 2, fmt.Errorf("Invalid upack.json: %v", err)
 	}
 
-	pkg.PrintManifest(info)
-
-	req, err := http.NewRequest("PUT", p._configuration.SourceFeedUrl, packageStream)
+	sha1, err := pkg.GetSHA1(path)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return nil, 1, err
 	}
+	return &pushPackage{path: path, info: info, size: fi.Size(), sha1: sha1}, 0, nil
+}
 
-	req.Header.Set("Content-Length", fmt.Sprintf("%d", fi.Size()))
-	req.Header.Set("Content-Type", "application/octet-stream")
+// 上传一个模块包,结果记录在pp.status与pp.detail中
+func (p *Push) pushPackage(ctx context.Context, feed *pkg.FeedClient, pp *pushPackage) {
+	info := pp.info
+	fail := func(err error) {
+		pp.status, pp.detail = PushFailed, err.Error()
+		fmt.Fprintln(os.Stderr, err)
+	}
 
-	if p._configuration.Authentication != nil {
-		req.SetBasicAuth(p._configuration.Authentication[0], p._configuration.Authentication[1])
+	if len(p.IfExists) > 0 {
+		reason, err := p.checkExisting(ctx, feed, info, pp.sha1)
+		if err != nil {
+			fail(err)
+			return
+		}
+		if len(reason) > 0 {
+			pp.status, pp.detail = PushSkipped, reason
+			return
+		}
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	f, err := os.Open(pp.path)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		fail(err)
+		return
+	}
+	defer f.Close()
+	err = feed.UploadFile(ctx, f, pp.size, info.GroupAndName()+"@"+info.Version())
+	if pkg.IsConflict(err) {
+		fail(fmt.Errorf("%s %s already exists in the feed, use --if-exists=skip or --if-exists=overwrite", info.GroupAndName(), info.Version()))
+		return
+	}
+	if err != nil {
+		fail(err)
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		fmt.Fprintln(os.Stderr, resp.Status)
-		return 1
+	reportResult(feed.Progress, pkg.ProgressUpload, info.GroupAndName(), info.GroupAndName()+" "+info.Version()+" published!")
+	pp.status = PushPublished
+
+	if !p.NoVerify {
+		remoteSHA1, err := getRemotePackageSHA1(ctx, feed, info.Group(), info.Name(), info.Version())
+		if err != nil {
+			fail(fmt.Errorf("Verifying published package %s %s: %v", info.GroupAndName(), info.Version(), err))
+			return
+		}
+		if !strings.EqualFold(remoteSHA1, pp.sha1) {
+			fail(fmt.Errorf("Package SHA1 value %s did not match remote SHA1 value %s", pp.sha1, remoteSHA1))
+			return
+		}
+		reportResult(feed.Progress, pkg.ProgressUpload, info.GroupAndName(), "Hashes for local and remote package match: "+pp.sha1)
+		pp.detail = "sha1 verified"
 	}
+}
 
-	fmt.Println(info.GroupAndName(), info.Version(), "published!")
+// 按照--if-exists处理feed中已存在的版本,返回不为空时跳过上传,值为跳过的原因
+func (p *Push) checkExisting(ctx context.Context, feed *pkg.FeedClient, info *pkg.UniversalPackageMetadata, localSHA1 string) (string, error) {
+	remoteSHA1, err := getRemotePackageSHA1(ctx, feed, info.Group(), info.Name(), info.Version())
+	if pkg.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
 
-	return 0
+	same := strings.EqualFold(remoteSHA1, localSHA1)
+	switch p.IfExists {
+	case PushIfExistsSkip:
+		if same {
+			reportResult(feed.Progress, pkg.ProgressUpload, info.GroupAndName(), info.GroupAndName()+" "+info.Version()+" already exists with the same SHA1, skipped")
+			return "already exists", nil
+		}
+		//sha1不同说明本地模块包与feed中的版本不一致,不能当作已发布
+		return "", fmt.Errorf("%s %s already exists in the feed with SHA1 %s, local SHA1 is %s, use --if-exists=overwrite to replace it", info.GroupAndName(), info.Version(), remoteSHA1, localSHA1)
+	case PushIfExistsOverwrite:
+		if same {
+			reportResult(feed.Progress, pkg.ProgressUpload, info.GroupAndName(), info.GroupAndName()+" "+info.Version()+" already exists with the same SHA1, nothing to overwrite")
+			return "already exists with the same SHA1", nil
+		}
+		//feed不允许上传已存在的版本,只能先删除再上传,上传失败时feed中将不再有该版本
+		reportResult(feed.Progress, pkg.ProgressUpload, info.GroupAndName(), info.GroupAndName()+" "+info.Version()+" already exists with SHA1 "+remoteSHA1+", deleting before upload")
+		return "", feed.Delete(ctx, info.Group(), info.Name(), info.Version())
+	}
+	if same {
+		return "", fmt.Errorf("%s %s already exists in the feed with the same SHA1", info.GroupAndName(), info.Version())
+	}
+	return "", fmt.Errorf("%s %s already exists in the feed with SHA1 %s, local SHA1 is %s", info.GroupAndName(), info.Version(), remoteSHA1, localSHA1)
+}
+
+func printPushSummary(progress pkg.ProgressReporter, packages []*pushPackage) {
+	counts := make(map[string]int)
+	out := summaryWriter(progress)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tVERSION\tSTATUS\tDETAIL")
+	for _, pp := range packages {
+		counts[pp.status]++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pp.info.GroupAndName(), pp.info.Version(), pp.status, pp.detail)
+	}
+	_ = w.Flush()
+	fmt.Fprintf(out, "%d published, %d skipped, %d failed\n", counts[PushPublished], counts[PushSkipped], counts[PushFailed])
 }
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPushIfExistsSkip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	feed, local := t.TempDir(), t.TempDir()
+	t.Setenv(_envKeySourceUrl, feed)
+	writeTestPackage(t, feed, "g", "a", "1.0.0", "a")
+	writeTestPackage(t, local, "g", "a", "1.0.0", "a")
+
+	p := &Push{Package: filepath.Join(local, "g"), IfExists: PushIfExistsSkip, Progress: "quiet"}
+	if exitCode := p.Run(); exitCode != 0 {
+		t.Fatalf("sha1 matches: exit code = %d, want 0", exitCode)
+	}
+
+	//feed中的版本与本地模块包sha1不同时不能跳过
+	writeTestPackage(t, local, "g", "b", "1.0.0", "b")
+	writeTestPackage(t, feed, "g", "b", "1.0.0", "changed")
+	p = &Push{Package: filepath.Join(local, "g"), IfExists: PushIfExistsSkip, Progress: "quiet"}
+	if exitCode := p.Run(); exitCode == 0 {
+		t.Fatal("sha1 mismatch: exit code = 0, want a failure")
+	}
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+type Search struct {
+	//搜索的关键字,匹配模块的组、名称、标题与描述,为空时列出所有模块
+	Term           string
+	SourceFeedName string
+	Group          string
+	Type           PackageType
+	Output         string
+
+	_configuration Configuration
+}
+
+type searchResult struct {
+	Group         string      `json:"group,omitempty"`
+	Name          string      `json:"name"`
+	LatestVersion string      `json:"latestVersion,omitempty"`
+	Title         string      `json:"title,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	Type          PackageType `json:"type,omitempty"`
+}
+
+func (*Search) Name() string { return "search" }
+func (*Search) Description() string {
+	return "在模块仓储中搜索模块."
+}
+
+func (s *Search) Help() string  { return pkg.DefaultCommandHelp(s) }
+func (s *Search) Usage() string { return pkg.DefaultCommandUsage(s) }
+
+func (*Search) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "term",
+			Description: "搜索的关键字,匹配模块的组、名称、标题与描述,为空时列出所有模块.",
+			Index:       0,
+			Optional:    true,
+			TrySetValue: pkg.TrySetStringValue("term", func(cmd pkg.Command) *string {
+				return &cmd.(*Search).Term
+			}),
+		},
+	}
+}
+
+func (*Search) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "feed",
+			Description: "模块仓储feed名称,为空时使用默认配置.",
+			TrySetValue: pkg.TrySetStringValue("feed", func(cmd pkg.Command) *string {
+				return &cmd.(*Search).SourceFeedName
+			}),
+		},
+		{
+			Name:        "group",
+			Description: "只搜索指定组中的模块.",
+			TrySetValue: pkg.TrySetStringValue("group", func(cmd pkg.Command) *string {
+				return &cmd.(*Search).Group
+			}),
+		},
+		{
+			Name:        "type",
+			Description: "只搜索指定类型(upack.json中的_type)的模块: plugin、app、tools.",
+			TrySetValue: pkg.TrySetStringFnValue("type", func(cmd pkg.Command) func(string) {
+				return func(s string) {
+					cmd.(*Search).Type = PackageType(s)
+				}
+			}),
+		},
+		{
+			Name:        "output",
+			Description: "输出格式: text(默认)、json.",
+			TrySetValue: pkg.TrySetStringValue("output", func(cmd pkg.Command) *string {
+				return &cmd.(*Search).Output
+			}),
+		},
+	}
+}
+
+func (s *Search) Run() int {
+	output, err := parseOutputFormat(s.Output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(s.Type) > 0 && !s.Type.IsValid() {
+		fmt.Fprintf(os.Stderr, "无效的模块类型: %s\n", s.Type)
+		return 2
+	}
+
+	if len(s.SourceFeedName) > 0 {
+		s._configuration = defaultConfigurationWithFeedName(s.SourceFeedName)
+	} else {
+		s._configuration = *defaultConfiguration()
+	}
+
+	results, err := s.search(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if output == OutputJSON {
+		err = printJSON(results)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tLATEST\tDESCRIPTION")
+	for _, result := range results {
+		description := result.Description
+		if len(description) <= 0 {
+			description = result.Title
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", groupAndName(result.Group, result.Name), result.LatestVersion, firstLine(description))
+	}
+	_ = w.Flush()
+	fmt.Println(len(results), "packages")
+	return 0
+}
+
+func (s *Search) search(ctx context.Context) ([]searchResult, error) {
+	feed := s._configuration.FeedClient()
+	packages, err := feed.ListPackages(ctx, s.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	term := strings.ToLower(strings.TrimSpace(s.Term))
+	results := make([]searchResult, 0, len(packages))
+	for _, p := range packages {
+		if len(s.Group) > 0 && !strings.EqualFold(p.Group, s.Group) {
+			continue
+		}
+		if len(term) > 0 && !matchSearchTerm(p, term) {
+			continue
+		}
+		results = append(results, searchResult{
+			Group:         p.Group,
+			Name:          p.Name,
+			LatestVersion: p.LatestVersion,
+			Title:         p.Title,
+			Description:   p.Description,
+		})
+	}
+	if len(s.Type) > 0 {
+		results = s.filterByType(ctx, feed, results)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return groupAndName(results[i].Group, results[i].Name) < groupAndName(results[j].Group, results[j].Name)
+	})
+	return results, nil
+}
+
+// 按模块类型过滤,模块列表中不包含_type,需要并行读取每个模块最新版本的upack.json,
+// 读取失败的模块给出警告后跳过
+func (s *Search) filterByType(ctx context.Context, feed *pkg.FeedClient, results []searchResult) []searchResult {
+	types := make([]PackageType, len(results))
+	parallelForEach(len(results), _defaultParallel, func(i int) {
+		packageType, err := getRemotePackageType(ctx, feed, results[i].Group, results[i].Name, results[i].LatestVersion)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 无法读取%s@%s的模块类型,已跳过: %v\n", groupAndName(results[i].Group, results[i].Name), results[i].LatestVersion, err)
+			return
+		}
+		types[i] = packageType
+	})
+
+	filtered := results[:0]
+	for i, result := range results {
+		if types[i] == s.Type {
+			result.Type = types[i]
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+func matchSearchTerm(p *pkg.RemotePackageMetadata, term string) bool {
+	for _, field := range []string{p.GroupAndName(), p.Title, p.Description} {
+		if strings.Contains(strings.ToLower(field), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// 读取模块upack.json中的_type,未指定时与install一致视为plugin
+func getRemotePackageType(ctx context.Context, feed *pkg.FeedClient, group, name, version string) (PackageType, error) {
+	metadata, err := feed.GetManifest(ctx, group, name, version)
+	if err != nil {
+		return "", fmt.Errorf("读取%s的upack.json失败: %v", groupAndName(group, name), err)
+	}
+	packageType, ok := (*metadata)[_metaPropertyName_Type].(string)
+	if !ok || len(packageType) <= 0 {
+		return PackageType_Plugin, nil
+	}
+	return PackageType(packageType), nil
+}
+
+func groupAndName(group, name string) string {
+	if len(group) <= 0 {
+		return name
+	}
+	return group + "/" + name
+}
+
+func firstLine(s string) string {
+	if index := strings.IndexAny(s, "\r\n"); index >= 0 {
+		return s[:index]
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchFilterByType(t *testing.T) {
+	// 模块名称与upack.json,值为空时读取失败
+	manifests := map[string]string{
+		"a":   `{"group":"g","name":"a","version":"1.0.0","_type":"app"}`,
+		"b":   `{"group":"g","name":"b","version":"1.0.0"}`,
+		"c":   `{"group":"g","name":"c","version":"1.0.0","_type":"app"}`,
+		"bad": "",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/upack/f/packages":
+			var packages []map[string]interface{}
+			for name := range manifests {
+				packages = append(packages, map[string]interface{}{"group": "g", "name": name, "latestVersion": "1.0.0", "versions": []string{"1.0.0"}})
+			}
+			_ = json.NewEncoder(w).Encode(packages)
+		case strings.HasPrefix(r.URL.Path, "/upack/f/download-file/g/") && r.URL.Query().Get("path") == "upack.json":
+			manifest := manifests[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/upack/f/download-file/g/"), "/1.0.0")]
+			if manifest == "" {
+				http.Error(w, "unavailable", http.StatusInternalServerError)
+				return
+			}
+			_, _ = io.WriteString(w, manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("HOME", t.TempDir())
+
+	for _, test := range []struct {
+		packageType PackageType
+		names       string
+	}{
+		{PackageType_App, "a c"},
+		{PackageType_Plugin, "b"},
+		{"", "a b bad c"},
+	} {
+		s := &Search{Type: test.packageType}
+		s._configuration.SetSourceFeedUrl(server.URL, "f")
+		results, err := s.search(context.Background())
+		if err != nil {
+			t.Fatalf("%q: %v", test.packageType, err)
+		}
+		var names []string
+		for _, result := range results {
+			names = append(names, result.Name)
+		}
+		if got := strings.Join(names, " "); got != test.names {
+			t.Errorf("%q: found %q, want %q", test.packageType, got, test.names)
+		}
+	}
+}
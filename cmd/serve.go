@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+const _defaultServeAddr = "127.0.0.1:8080"
+
+type Serve struct {
+	//模块包所在目录
+	Root string
+	//监听地址,如:8080
+	Addr string
+	//上传模块包的最大长度,如2GB
+	MaxUploadSize string
+	//basic认证的用户名与密码
+	User *[2]string
+	//通过X-ApiKey请求头、bearer token或者api:«api-key»的basic认证访问
+	ApiKey string
+	//从文件读取api key,避免api key出现在命令行中
+	ApiKeyFile string
+	//允许未认证的读取请求,只有上传与删除需要认证
+	AnonymousRead bool
+	//上游模块仓储地址,格式与plugininstaller_sourceUrl相同,指定后/upack/«feed»/中不存在的模块从上游同名feed读取并缓存
+	Upstream string
+	//访问上游模块仓储的api key
+	UpstreamApiKey string
+	//上游api key的认证方式:basic、apikey或bearer,默认为basic
+	UpstreamAuthType string
+	//上游模块与版本列表的缓存时间,如5m
+	CacheTTL string
+
+	_cacheTTL      time.Duration
+	_maxUploadSize int64
+	_configuration Configuration
+	_feeds         sync.Map
+}
+
+func (*Serve) Name() string { return "serve" }
+func (*Serve) Description() string {
+	return "将目录中的.upack文件作为模块仓储提供http服务."
+}
+
+func (s *Serve) Help() string  { return pkg.DefaultCommandHelp(s) }
+func (s *Serve) Usage() string { return pkg.DefaultCommandUsage(s) }
+
+func (*Serve) PositionalArguments() []pkg.PositionalArgument {
+	return nil
+}
+
+func (*Serve) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "root",
+			Description: "模块包所在目录,其中的子目录可以通过/upack/«子目录»/作为单独的feed访问.",
+			Required:    true,
+			TrySetValue: pkg.TrySetPathValue("root", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).Root
+			}),
+		},
+		{
+			Name:        "addr",
+			Description: fmt.Sprintf("监听地址,默认为%s,只接受本机的请求;如:8080监听所有网卡.", _defaultServeAddr),
+			TrySetValue: pkg.TrySetStringValue("addr", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).Addr
+			}),
+		},
+		{
+			Name:        "max-upload-size",
+			Description: "上传模块包的最大长度,如500MB,默认为2GB.",
+			TrySetValue: pkg.TrySetStringValue("max-upload-size", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).MaxUploadSize
+			}),
+		},
+		{
+			Name:        "user",
+			Description: "basic认证的用户名与密码,格式为«username»:«password»;未指定--user与--api-key时服务为只读.",
+			TrySetValue: pkg.TrySetBasicAuthValue("user", func(cmd pkg.Command) **[2]string {
+				return &cmd.(*Serve).User
+			}),
+		},
+		{
+			Name:        "api-key",
+			Description: "api key,客户端通过X-ApiKey请求头、Authorization: Bearer «api-key»或者api:«api-key»的basic认证访问.",
+			TrySetValue: pkg.TrySetStringValue("api-key", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).ApiKey
+			}),
+		},
+		{
+			Name:        "api-key-file",
+			Description: "从文件读取api key,避免api key出现在命令行与进程列表中.",
+			TrySetValue: pkg.TrySetPathValue("api-key-file", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).ApiKeyFile
+			}),
+		},
+		{
+			Name:        "anonymous-read",
+			Description: "允许未认证的读取请求,只有上传与删除需要认证.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("anonymous-read", func(cmd pkg.Command) *bool {
+				return &cmd.(*Serve).AnonymousRead
+			}),
+		},
+		{
+			Name:        "upstream",
+			Description: "上游模块仓储地址,如http://proget:8624,/upack/«feed»/中不存在的模块从上游同名feed下载并缓存到«root»/«feed»/packageCache中.",
+			TrySetValue: pkg.TrySetStringValue("upstream", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).Upstream
+			}),
+		},
+		{
+			Name:        "upstream-api-key",
+			Description: "访问上游模块仓储的api key,为空时使用login保存的凭据.",
+			TrySetValue: pkg.TrySetStringValue("upstream-api-key", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).UpstreamApiKey
+			}),
+		},
+		{
+			Name:        "upstream-auth-type",
+			Description: "上游api key的认证方式:basic、apikey(X-ApiKey请求头)或bearer,默认为basic.",
+			TrySetValue: pkg.TrySetStringValue("upstream-auth-type", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).UpstreamAuthType
+			}),
+		},
+		{
+			Name:        "cache-ttl",
+			Description: fmt.Sprintf("上游模块与版本列表的缓存时间,默认为%s.", pkg.DefaultCacheTTL),
+			TrySetValue: pkg.TrySetStringValue("cache-ttl", func(cmd pkg.Command) *string {
+				return &cmd.(*Serve).CacheTTL
+			}),
+		},
+	}
+}
+
+func (s *Serve) Run() int {
+	fi, err := os.Stat(s.Root)
+	if err != nil || !fi.IsDir() {
+		fmt.Fprintf(os.Stderr, "目录%s不存在\n", s.Root)
+		return 2
+	}
+	if len(s.Addr) <= 0 {
+		s.Addr = _defaultServeAddr
+	}
+	if len(s.ApiKeyFile) > 0 {
+		s.ApiKey, err = readSecret(nil, false, s.ApiKeyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if len(s.MaxUploadSize) > 0 {
+		size, ok := toSize(s.MaxUploadSize)
+		if !ok || size <= 0 {
+			fmt.Fprintf(os.Stderr, "无效的--max-upload-size: %s\n", s.MaxUploadSize)
+			return 2
+		}
+		s._maxUploadSize = size
+	}
+	s._cacheTTL = pkg.DefaultCacheTTL
+	if len(s.CacheTTL) > 0 {
+		s._cacheTTL, err = parseAge(s.CacheTTL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	//读取http设置,用于访问上游模块仓储
+	s._configuration = *defaultConfiguration()
+	if len(s.UpstreamApiKey) > 0 {
+		if _, err = pkg.NewAuthenticator(s.upstreamAuth()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	fmt.Printf("serving %s on %s\n", s.Root, s.Addr)
+	if len(s.Upstream) > 0 {
+		fmt.Printf("caching packages from %s, listings for %s\n", s.Upstream, s._cacheTTL)
+	}
+	if !s.writable() {
+		fmt.Println("未指定--user或--api-key,服务为只读,不接受上传与删除")
+	}
+	err = server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	<-done
+	return 0
+}
+
+func (s *Serve) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	defer func() {
+		fmt.Printf("%s %s %s %d %s\n", r.RemoteAddr, r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Millisecond))
+	}()
+
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if !readOnly && !s.writable() {
+		http.Error(recorder, "server is read-only, start serve with --user or --api-key to allow uploads and deletes", http.StatusForbidden)
+		return
+	}
+	if !(readOnly && s.AnonymousRead) && !s.authorized(r) {
+		recorder.Header().Set("WWW-Authenticate", `Basic realm="upack"`)
+		http.Error(recorder, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	feed, rel, ok := s.feed(r.Context(), r.URL.EscapedPath())
+	if !ok {
+		http.NotFound(recorder, r)
+		return
+	}
+	u := *r.URL
+	u.RawPath = rel
+	u.Path, _ = url.PathUnescape(rel)
+	req := r.Clone(r.Context())
+	req.URL = &u
+	feed.ServeHTTP(recorder, req)
+}
+
+// 根目录作为默认feed,/upack/«子目录»/访问子目录中的feed,与ProGet的地址格式一致;
+// 指定了上游时子目录作为上游同名feed的缓存,子目录不存在时在上游确认存在该feed后自动创建
+func (s *Serve) feed(ctx context.Context, escapedPath string) (http.Handler, string, bool) {
+	if !strings.HasPrefix(escapedPath, "/upack/") {
+		return s.directoryFeed(s.Root), escapedPath, true
+	}
+	parts := strings.SplitN(strings.TrimPrefix(escapedPath, "/upack/"), "/", 2)
+	feedName := parts[0]
+	if len(feedName) <= 0 || feedName == "." || feedName == ".." || strings.ContainsAny(feedName, `\%`) {
+		return nil, "", false
+	}
+	rel := "/"
+	if len(parts) > 1 {
+		rel += parts[1]
+	}
+	root := filepath.Join(s.Root, feedName)
+	if len(s.Upstream) > 0 {
+		feed, err := s.cachingFeed(ctx, root, feedName)
+		if pkg.IsNotFound(err) {
+			return nil, "", false
+		}
+		if err != nil {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+			}), rel, true
+		}
+		return feed, rel, true
+	}
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return nil, "", false
+	}
+	return s.directoryFeed(root), rel, true
+}
+
+// 本地子目录不存在时先读取上游的模块列表,上游不存在该feed时返回404错误,不创建目录,
+// 避免任意的feed名称在根目录中创建子目录
+func (s *Serve) cachingFeed(ctx context.Context, root, feedName string) (*pkg.CachingFeed, error) {
+	if feed, ok := s._feeds.Load(root); ok {
+		return feed.(*pkg.CachingFeed), nil
+	}
+	upstream := pkg.NewFeedClient(getSourceFeedUrl(s.Upstream, feedName), nil)
+	upstream.Authenticator = s._configuration.feedAuthenticator(upstream.FeedURL, s.upstreamAuth())
+	upstream.HTTPClient = s._configuration.HTTPClient()
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		if _, err = upstream.ListPackages(ctx, ""); err != nil {
+			return nil, errors.Wrapf(err, "upstream feed %s", feedName)
+		}
+		if err = os.MkdirAll(root, 0755); err != nil {
+			return nil, err
+		}
+	}
+	feed, _ := s._feeds.LoadOrStore(root, pkg.NewCachingFeed(s.directoryFeed(root), upstream, s._cacheTTL))
+	return feed.(*pkg.CachingFeed), nil
+}
+
+// 上游的认证设置,bearer方式时api key作为token
+func (s *Serve) upstreamAuth() pkg.AuthOptions {
+	if len(s.UpstreamApiKey) <= 0 {
+		return pkg.AuthOptions{}
+	}
+	options := pkg.AuthOptions{Type: s.UpstreamAuthType}
+	if strings.EqualFold(s.UpstreamAuthType, pkg.AuthTypeBearer) {
+		options.Token = s.UpstreamApiKey
+	} else {
+		options.APIKey = s.UpstreamApiKey
+	}
+	return options
+}
+
+func (s *Serve) directoryFeed(root string) *pkg.DirectoryFeed {
+	if feed, ok := s._feeds.Load("dir:" + root); ok {
+		return feed.(*pkg.DirectoryFeed)
+	}
+	directoryFeed := pkg.NewDirectoryFeed(root)
+	directoryFeed.MaxUploadSize = s._maxUploadSize
+	feed, _ := s._feeds.LoadOrStore("dir:"+root, directoryFeed)
+	return feed.(*pkg.DirectoryFeed)
+}
+
+// 只有配置了认证信息时才接受上传与删除
+func (s *Serve) writable() bool {
+	return s.User != nil || len(s.ApiKey) > 0
+}
+
+// 未配置认证信息时允许所有读取请求
+func (s *Serve) authorized(r *http.Request) bool {
+	if !s.writable() {
+		return true
+	}
+	if len(s.ApiKey) > 0 && secureEqual(r.Header.Get("X-ApiKey"), s.ApiKey) {
+		return true
+	}
+	if token := r.Header.Get("Authorization"); len(s.ApiKey) > 0 && len(token) > 7 && strings.EqualFold(token[:7], "bearer ") &&
+		secureEqual(strings.TrimSpace(token[7:]), s.ApiKey) {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	if s.User != nil && secureEqual(username, s.User[0]) && secureEqual(password, s.User[1]) {
+		return true
+	}
+	return len(s.ApiKey) > 0 && username == "api" && secureEqual(password, s.ApiKey)
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.status = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeUpstreamCreatesOnlyExistingFeeds(t *testing.T) {
+	var requests int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/upack/known/packages" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, "[]")
+	}))
+	defer upstream.Close()
+
+	s := &Serve{Root: t.TempDir(), Upstream: upstream.URL, AnonymousRead: true}
+	s._configuration = *defaultConfiguration()
+	for _, test := range []struct {
+		feedName string
+		status   int
+	}{
+		{"unknown", http.StatusNotFound},
+		{"known", http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upack/"+test.feedName+"/packages", nil))
+		if rec.Code != test.status {
+			t.Errorf("%s: status = %d, want %d: %s", test.feedName, rec.Code, test.status, rec.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "unknown")); !os.IsNotExist(err) {
+		t.Errorf("directory was created for a feed that does not exist upstream: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(s.Root, "known")); err != nil || !fi.IsDir() {
+		t.Errorf("directory was not created for an upstream feed: %v", err)
+	}
+
+	//已确认的feed不再检查上游
+	requests = 0
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upack/known/packages", nil))
+	if rec.Code != http.StatusOK || requests > 1 {
+		t.Errorf("status = %d, upstream requests = %d", rec.Code, requests)
+	}
+}
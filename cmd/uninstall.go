@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shanluzhineng/upack/pkg"
+)
+
+type Uninstall struct {
+	//模块所属组、名称、版本的组合名称, 格式使用: 所属组/名称@版本，版本为空时卸载所有已安装的版本
+	PackageName string
+	//是否禁止执行upack.json中声明的preUninstall脚本
+	NoScripts bool
+}
+
+func (*Uninstall) Name() string { return "uninstall" }
+func (*Uninstall) Description() string {
+	return "从插件目录中卸载已安装的模块."
+}
+
+func (u *Uninstall) Help() string  { return pkg.DefaultCommandHelp(u) }
+func (u *Uninstall) Usage() string { return pkg.DefaultCommandUsage(u) }
+
+func (*Uninstall) PositionalArguments() []pkg.PositionalArgument {
+	return []pkg.PositionalArgument{
+		{
+			Name:        "package",
+			Description: "模块所属组、名称、版本的组合名称, 格式使用: 所属组/名称@版本,版本为空时卸载所有已安装的版本",
+			Index:       0,
+			TrySetValue: pkg.TrySetStringValue("package", func(cmd pkg.Command) *string {
+				return &cmd.(*Uninstall).PackageName
+			}),
+		},
+	}
+}
+
+func (*Uninstall) ExtraArguments() []pkg.ExtraArgument {
+	return []pkg.ExtraArgument{
+		{
+			Name:        "no-scripts",
+			Description: "不执行upack.json中声明的preUninstall脚本.",
+			Flag:        true,
+			TrySetValue: pkg.TrySetBoolValue("no-scripts", func(cmd pkg.Command) *bool {
+				return &cmd.(*Uninstall).NoScripts
+			}),
+		},
+	}
+}
+
+func (u *Uninstall) Run() int {
+	info, err := parsePackageNameWithVersion(u.PackageName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无效的模块名:%s\n", u.PackageName)
+		return 2
+	}
+
+	r := pkg.PlugIns
+	packages, err := r.ListInstalledPackages()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	//指定了target时不同版本可能安装到同一目录,不删除其它模块仍在使用的目录
+	var removed []*pkg.InstalledPackage
+	var keptPaths []string
+	for _, installed := range packages {
+		if !strings.EqualFold(installed.Group, info.group) || !strings.EqualFold(installed.Name, info.name) ||
+			len(info.version) > 0 && !strings.EqualFold(installed.Version.String(), info.version) {
+			if installed.Path != nil {
+				keptPaths = append(keptPaths, *installed.Path)
+			}
+			continue
+		}
+		removed = append(removed, installed)
+	}
+
+	for _, installed := range removed {
+		err = uninstallPackage(r, installed, keptPaths, u.NoScripts, nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if len(removed) <= 0 {
+		fmt.Fprintf(os.Stderr, "模块%s未安装.\n", u.PackageName)
+		return 1
+	}
+	return 0
+}
+
+// 执行preUninstall脚本,删除安装目录并从注册表中移除模块;
+// 安装目录与keptPaths中的目录相同、包含或者位于其中时只从注册表中移除,不执行脚本也不删除文件;
+// 脚本的输出与卸载结果通过progress输出
+func uninstallPackage(r pkg.Registry, installed *pkg.InstalledPackage, keptPaths []string, noScripts bool, progress pkg.ProgressReporter) error {
+	var targetDirectory string
+	if installed.Path != nil {
+		targetDirectory = *installed.Path
+	}
+	for _, keptPath := range keptPaths {
+		if len(targetDirectory) > 0 && pathsOverlap(targetDirectory, keptPath) {
+			fmt.Fprintf(os.Stderr, "%s的安装目录%s与%s重叠,只从注册表中移除,不删除文件\n", installed.PackageName(), targetDirectory, keptPath)
+			targetDirectory = ""
+			break
+		}
+	}
+
+	if !noScripts && len(targetDirectory) > 0 {
+		metadata, err := r.GetInstalledManifest(installed.Group, installed.Name, installed.Version)
+		if err != nil {
+			return err
+		}
+		err = pkg.RunHook(metadata, pkg.HookPreUninstall, pkg.HookEnvironment{
+			Group:           installed.Group,
+			Name:            installed.Name,
+			Version:         installed.Version.String(),
+			TargetDirectory: targetDirectory,
+			Progress:        progress,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(targetDirectory) > 0 {
+		err := os.RemoveAll(targetDirectory)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := r.UnregisterPackage(installed.Group, installed.Name, installed.Version)
+	if err != nil {
+		return err
+	}
+	reportResult(progress, pkg.ProgressUninstall, installed.PackageName(), installed.PackageName()+" uninstalled!")
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/shanluzhineng/upack/cmd/cast"
 	"github.com/pkg/errors"
@@ -144,3 +145,30 @@ func moveCrossDevice(source, destination string) error {
 	os.Remove(source)
 	return nil
 }
+
+// 使用最多parallel个goroutine并行执行task,task的参数为任务的序号
+func parallelForEach(count, parallel int, task func(index int)) {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	if parallel > count {
+		parallel = count
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < parallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				task(index)
+			}
+		}()
+	}
+	for index := 0; index < count; index++ {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// 认证方式
+const (
+	AuthTypeBasic  = "basic"
+	AuthTypeAPIKey = "apikey"
+	AuthTypeBearer = "bearer"
+)
+
+// 为发往模块仓储的请求添加认证信息
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// basic认证
+type BasicAuthenticator struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuthenticator) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// 通过X-ApiKey请求头传递api key,用于不接受basic认证的网关
+type APIKeyAuthenticator struct {
+	Key string
+}
+
+func (a APIKeyAuthenticator) Authenticate(req *http.Request) error {
+	req.Header.Set("X-ApiKey", a.Key)
+	return nil
+}
+
+// 跟随重定向时只向原来的主机发送X-ApiKey请求头.
+// http.Client在主机变化时只会去掉Authorization与Cookie,重定向到CDN或对象存储时api key会被发送给第三方
+func RedirectSafeClient(client *http.Client) *http.Client {
+	c := *client
+	checkRedirect := client.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			req.Header.Del("X-ApiKey")
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &c
+}
+
+// bearer token认证,token依次从Token、TokenEnv环境变量、TokenFile文件中读取;
+// 环境变量与文件在每次请求时读取,token更新后不需要重新启动
+type BearerTokenAuthenticator struct {
+	Token     string
+	TokenEnv  string
+	TokenFile string
+}
+
+func (a BearerTokenAuthenticator) Authenticate(req *http.Request) error {
+	token, err := a.token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a BearerTokenAuthenticator) token() (string, error) {
+	if a.Token != "" {
+		return a.Token, nil
+	}
+	if a.TokenEnv != "" {
+		if token := strings.TrimSpace(os.Getenv(a.TokenEnv)); token != "" {
+			return token, nil
+		}
+		if a.TokenFile == "" {
+			return "", errors.Errorf("environment variable %s is not set", a.TokenEnv)
+		}
+	}
+	data, err := os.ReadFile(a.TokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "reading bearer token")
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.Errorf("bearer token file %s is empty", a.TokenFile)
+	}
+	return token, nil
+}
+
+// 访问模块仓储的认证设置
+type AuthOptions struct {
+	// basic、apikey或bearer,为空时根据其它设置推断:指定了token时使用bearer,否则使用basic
+	Type string
+	// basic认证的用户名与密码,用户名为空时使用api:«APIKey»
+	Username string
+	Password string
+	APIKey   string
+	// bearer token,也可以从环境变量或文件中读取
+	Token     string
+	TokenEnv  string
+	TokenFile string
+}
+
+func (options AuthOptions) hasToken() bool {
+	return options.Token != "" || options.TokenEnv != "" || options.TokenFile != ""
+}
+
+// 根据设置创建Authenticator,未设置任何认证信息时返回nil
+func NewAuthenticator(options AuthOptions) (Authenticator, error) {
+	authType := strings.ToLower(options.Type)
+	if authType == "" {
+		switch {
+		case options.hasToken():
+			authType = AuthTypeBearer
+		case options.Username != "" || options.APIKey != "":
+			authType = AuthTypeBasic
+		default:
+			return nil, nil
+		}
+	}
+
+	switch authType {
+	case AuthTypeBasic:
+		if options.Username != "" {
+			return BasicAuthenticator{Username: options.Username, Password: options.Password}, nil
+		}
+		if options.APIKey == "" {
+			return nil, errors.New("basic authentication requires a username or an api key")
+		}
+		return BasicAuthenticator{Username: "api", Password: options.APIKey}, nil
+	case AuthTypeAPIKey:
+		if options.APIKey == "" {
+			return nil, errors.New("apikey authentication requires an api key")
+		}
+		return APIKeyAuthenticator{Key: options.APIKey}, nil
+	case AuthTypeBearer:
+		if !options.hasToken() {
+			return nil, errors.New("bearer authentication requires a token, token environment variable or token file")
+		}
+		return BearerTokenAuthenticator{Token: options.Token, TokenEnv: options.TokenEnv, TokenFile: options.TokenFile}, nil
+	}
+	return nil, errors.Errorf("unknown authentication type '%s'", options.Type)
+}
+
+// 设置无效时使用,所有请求都返回创建时的错误
+type errorAuthenticator struct {
+	err error
+}
+
+func (a errorAuthenticator) Authenticate(*http.Request) error {
+	return a.err
+}
+
+// 与NewAuthenticator相同,但设置无效时返回的Authenticator在发送请求时返回错误
+func (options AuthOptions) Authenticator() Authenticator {
+	authenticator, err := NewAuthenticator(options)
+	if err != nil {
+		return errorAuthenticator{err: errors.Wrap(err, "invalid authentication configuration")}
+	}
+	return authenticator
+}
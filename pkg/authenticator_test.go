@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyNotForwardedOnCrossHostRedirect(t *testing.T) {
+	var cdnKey, feedKey string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnKey = r.Header.Get("X-ApiKey")
+		_, _ = io.WriteString(w, "package")
+	}))
+	defer cdn.Close()
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download/n/1.0.0":
+			http.Redirect(w, r, cdn.URL+"/blob/1", http.StatusFound)
+		case "/download/n/2.0.0":
+			http.Redirect(w, r, "/blob/2", http.StatusFound)
+		default:
+			feedKey = r.Header.Get("X-ApiKey")
+			_, _ = io.WriteString(w, "package")
+		}
+	}))
+	defer feed.Close()
+
+	client := &FeedClient{FeedURL: feed.URL + "/", Authenticator: APIKeyAuthenticator{Key: "secret"}}
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		body, _, err := client.Download(context.Background(), "", "n", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, body)
+		_ = body.Close()
+	}
+	if cdnKey != "" {
+		t.Errorf("api key was sent to the redirect target on another host: %q", cdnKey)
+	}
+	if feedKey != "secret" {
+		t.Errorf("api key was not sent on a same-host redirect: %q", feedKey)
+	}
+}
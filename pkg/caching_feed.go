@@ -0,0 +1,339 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 版本列表默认的缓存时间
+const DefaultCacheTTL = 5 * time.Minute
+
+// 拉取式缓存feed:本地目录中不存在的模块从上游feed读取,下载的模块包按照Registry的缓存目录结构
+// 保存到本地目录中,之后直接从本地提供;模块与版本列表在内存中缓存TTL时长,上游无法访问时使用过期的缓存
+type CachingFeed struct {
+	Local    *DirectoryFeed
+	Upstream *FeedClient
+	TTL      time.Duration
+
+	mu       sync.Mutex
+	listings map[string]*cachedListing
+	// 每个模块版本一个锁,避免同时从上游下载同一个模块包
+	downloads sync.Map
+}
+
+type cachedListing struct {
+	value   interface{}
+	expires time.Time
+}
+
+func NewCachingFeed(local *DirectoryFeed, upstream *FeedClient, ttl time.Duration) *CachingFeed {
+	return &CachingFeed{
+		Local:    local,
+		Upstream: upstream,
+		TTL:      ttl,
+		listings: make(map[string]*cachedListing),
+	}
+}
+
+// 读取缓存的上游列表,过期时重新读取,上游无法访问时使用过期的缓存
+func (c *CachingFeed) cached(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	listing := c.listings[key]
+	c.mu.Unlock()
+	if listing != nil && time.Now().Before(listing.expires) {
+		return listing.value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		if listing != nil && !IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v, using cached listing\n", c.Upstream.FeedURL, err)
+			return listing.value, nil
+		}
+		return nil, err
+	}
+	c.mu.Lock()
+	c.listings[key] = &cachedListing{value: value, expires: time.Now().Add(c.TTL)}
+	c.mu.Unlock()
+	return value, nil
+}
+
+func (c *CachingFeed) upstreamPackage(ctx context.Context, group, name string) (*RemotePackageMetadata, error) {
+	value, err := c.cached("packages?"+strings.ToLower(groupAndName(group, name)), func() (interface{}, error) {
+		return c.Upstream.GetPackage(ctx, group, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*RemotePackageMetadata), nil
+}
+
+func (c *CachingFeed) upstreamPackages(ctx context.Context, group string) ([]*RemotePackageMetadata, error) {
+	value, err := c.cached("packages?group="+strings.ToLower(group), func() (interface{}, error) {
+		return c.Upstream.ListPackages(ctx, group)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]*RemotePackageMetadata), nil
+}
+
+func (c *CachingFeed) upstreamVersions(ctx context.Context, group, name string) ([]*RemotePackageVersion, error) {
+	value, err := c.cached("versions?"+strings.ToLower(groupAndName(group, name)), func() (interface{}, error) {
+		return c.Upstream.ListVersions(ctx, group, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]*RemotePackageVersion), nil
+}
+
+func (c *CachingFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		//上传与删除只作用于本地目录
+		c.Local.ServeHTTP(w, r)
+		return
+	}
+	index, err := c.Local.snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	segments := feedPathSegments(r)
+	query := r.URL.Query()
+	_, latest := query["latest"]
+
+	switch segments[0] {
+	case "packages":
+		c.servePackages(w, r, index, query.Get("group"), query.Get("name"))
+	case "versions":
+		c.serveVersions(w, r, index, query.Get("group"), query.Get("name"), query.Get("version"))
+	case "download", "download-file":
+		group, name, version, ok := parseDirectoryFeedPackagePath(segments[1:], latest)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if segments[0] == "download" {
+			c.serveDownload(w, r, index, group, name, version)
+		} else {
+			c.serveDownloadFile(w, r, index, group, name, version, query.Get("path"))
+		}
+	default:
+		c.Local.ServeHTTP(w, r)
+	}
+}
+
+// 上游返回的错误,模块不存在时返回404,其它错误返回502
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	if IsNotFound(err) {
+		http.Error(w, "package not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "upstream feed: "+err.Error(), http.StatusBadGateway)
+}
+
+// 合并上游与本地的模块信息,版本按版本号从高到低排序
+func mergePackageMetadata(upstream *RemotePackageMetadata, local []*directoryIndexEntry) *RemotePackageMetadata {
+	var merged RemotePackageMetadata
+	if upstream != nil {
+		merged = *upstream
+	} else {
+		merged = *newDirectoryPackageMetadata(local)
+	}
+	seen := make(map[string]bool)
+	var versions []*UniversalPackageVersion
+	add := func(v string) {
+		version, err := ParseUniversalPackageVersion(v)
+		if err == nil && !seen[version.String()] {
+			seen[version.String()] = true
+			versions = append(versions, version)
+		}
+	}
+	if upstream != nil {
+		for _, v := range upstream.Versions {
+			add(v)
+		}
+	}
+	for _, entry := range local {
+		add(entry.Version)
+	}
+	sort.Slice(versions, func(a, b int) bool {
+		return versions[a].Compare(versions[b]) > 0
+	})
+	merged.Versions = make([]string, 0, len(versions))
+	for _, version := range versions {
+		merged.Versions = append(merged.Versions, version.String())
+	}
+	if len(versions) > 0 {
+		merged.LatestVersion = versions[0].String()
+	}
+	return &merged
+}
+
+func (c *CachingFeed) servePackages(w http.ResponseWriter, r *http.Request, index directoryIndexMap, group, name string) {
+	if len(name) > 0 {
+		local := index.findVersions(group, name)
+		upstream, err := c.upstreamPackage(r.Context(), group, name)
+		if err != nil {
+			if len(local) <= 0 {
+				writeUpstreamError(w, err)
+				return
+			}
+			if !IsNotFound(err) {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", c.Upstream.FeedURL, err)
+			}
+		}
+		writeDirectoryFeedJSON(w, mergePackageMetadata(upstream, local))
+		return
+	}
+
+	upstream, err := c.upstreamPackages(r.Context(), group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", c.Upstream.FeedURL, err)
+	}
+	localPackages := make(map[string][]*directoryIndexEntry)
+	for _, entry := range index {
+		if entry.Invalid == "" && (len(group) <= 0 || strings.EqualFold(entry.Group, group)) {
+			key := strings.ToLower(entry.GroupAndName())
+			localPackages[key] = append(localPackages[key], entry)
+		}
+	}
+	packages := make([]*RemotePackageMetadata, 0, len(upstream)+len(localPackages))
+	for _, p := range upstream {
+		key := strings.ToLower(p.GroupAndName())
+		packages = append(packages, mergePackageMetadata(p, localPackages[key]))
+		delete(localPackages, key)
+	}
+	for _, entries := range localPackages {
+		sortDirectoryEntries(entries)
+		packages = append(packages, mergePackageMetadata(nil, entries))
+	}
+	sort.SliceStable(packages, func(a, b int) bool {
+		return strings.ToLower(packages[a].GroupAndName()) < strings.ToLower(packages[b].GroupAndName())
+	})
+	writeDirectoryFeedJSON(w, packages)
+}
+
+func (c *CachingFeed) serveVersions(w http.ResponseWriter, r *http.Request, index directoryIndexMap, group, name, version string) {
+	if len(version) > 0 {
+		if entry := index.findVersion(group, name, version); entry != nil {
+			writeDirectoryFeedJSON(w, entry.RemotePackageVersion)
+			return
+		}
+		remote, err := c.Upstream.GetVersion(r.Context(), group, name, version)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		writeDirectoryFeedJSON(w, remote)
+		return
+	}
+
+	upstream, err := c.upstreamVersions(r.Context(), group, name)
+	if err != nil && !IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", c.Upstream.FeedURL, err)
+	}
+	seen := make(map[string]bool)
+	versions := make([]RemotePackageVersion, 0, len(upstream))
+	for _, v := range upstream {
+		seen[strings.ToLower(v.GroupAndName()+"@"+v.Version)] = true
+		versions = append(versions, *v)
+	}
+	for _, entry := range index {
+		if entry.Invalid != "" || (len(group) > 0 && !strings.EqualFold(entry.Group, group)) || (len(name) > 0 && !strings.EqualFold(entry.Name, name)) {
+			continue
+		}
+		if !seen[strings.ToLower(entry.GroupAndName()+"@"+entry.Version)] {
+			versions = append(versions, entry.RemotePackageVersion)
+		}
+	}
+	writeDirectoryFeedJSON(w, versions)
+}
+
+// 解析需要的版本,version为空时使用上游与本地合并后的最新版本
+func (c *CachingFeed) resolveVersion(ctx context.Context, index directoryIndexMap, group, name, version string) (*UniversalPackageVersion, error) {
+	if len(version) > 0 {
+		return ParseUniversalPackageVersion(version)
+	}
+	local := index.findVersions(group, name)
+	upstream, err := c.upstreamPackage(ctx, group, name)
+	if err != nil {
+		if len(local) <= 0 {
+			return nil, err
+		}
+		if !IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", c.Upstream.FeedURL, err)
+		}
+	}
+	return ParseUniversalPackageVersion(mergePackageMetadata(upstream, local).LatestVersion)
+}
+
+func (c *CachingFeed) serveDownload(w http.ResponseWriter, r *http.Request, index directoryIndexMap, group, name, version string) {
+	v, err := c.resolveVersion(r.Context(), index, group, name, version)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	if index.findVersion(group, name, v.String()) == nil {
+		err = c.fetch(group, name, v)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		index, err = c.Local.snapshot()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	c.Local.serveDownload(w, r, index, group, name, v.String())
+}
+
+// 从上游下载模块包到本地目录的缓存中
+func (c *CachingFeed) fetch(group, name string, version *UniversalPackageVersion) error {
+	key := strings.ToLower(groupAndName(group, name) + "@" + version.String())
+	lock, _ := c.downloads.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	registry := Registry(c.Local.Root)
+	if _, err := os.Stat(registry.getCachedPackagePath(group, name, version)); err == nil {
+		return nil
+	}
+	fmt.Printf("caching %s@%s from %s\n", groupAndName(group, name), version, c.Upstream.FeedURL)
+	_, done, err := registry.GetOrDownloadFromFeed(c.Upstream, group, name, version, true)
+	if err != nil {
+		return err
+	}
+	return done()
+}
+
+// upack.json等单个文件不缓存,本地不存在该版本时直接从上游读取
+func (c *CachingFeed) serveDownloadFile(w http.ResponseWriter, r *http.Request, index directoryIndexMap, group, name, version, filePath string) {
+	v, err := c.resolveVersion(r.Context(), index, group, name, version)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	if index.findVersion(group, name, v.String()) != nil {
+		c.Local.serveDownloadFile(w, r, index, group, name, v.String(), filePath)
+		return
+	}
+	body, err := c.Upstream.DownloadFile(r.Context(), group, name, v.String(), filePath)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = io.Copy(w, body)
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 上游为本地目录feed,其中有一个没有组的模块和一个有组的模块
+func testCachingFeed(t *testing.T) *CachingFeed {
+	t.Helper()
+	upstreamRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(upstreamRoot, "n-1.0.0.upack"), testPackage(t, map[string]interface{}{"name": "n", "version": "1.0.0"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(upstreamRoot, "g", "h"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(upstreamRoot, "g", "h", "m-2.0.0.upack"), testPackage(t, map[string]interface{}{"group": "g/h", "name": "m", "version": "2.0.0"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	upstream := NewFeedClient(upstreamRoot, nil)
+	return NewCachingFeed(NewDirectoryFeed(t.TempDir()), upstream, time.Minute)
+}
+
+func TestCachingFeedDownloadCachesPackage(t *testing.T) {
+	feed := testCachingFeed(t)
+	for _, target := range []string{"/download/n/1.0.0", "/download/g/h/m/2.0.0"} {
+		//第一次从上游下载并缓存,第二次直接从本地提供
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			feed.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s (%d): status = %d: %s", target, i, rec.Code, rec.Body.String())
+			}
+		}
+	}
+	for _, cached := range []string{
+		filepath.Join("packageCache", "$n", "n.1.0.0.upack"),
+		filepath.Join("packageCache", "g$h$m", "m.2.0.0.upack"),
+	} {
+		if _, err := os.Stat(filepath.Join(feed.Local.Root, cached)); err != nil {
+			t.Errorf("package was not cached: %v", err)
+		}
+	}
+
+	index, err := feed.Local.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := index.findVersion("", "n", "1.0.0"); entry == nil {
+		t.Errorf("cached package without group is not indexed as n: %v", index)
+	}
+	if entry := index.findVersion("g/h", "m", "2.0.0"); entry == nil {
+		t.Errorf("cached package is not indexed as g/h/m: %v", index)
+	}
+}
+
+func TestCachingFeedListsCachedPackagesUnderTheirGroup(t *testing.T) {
+	feed := testCachingFeed(t)
+	rec := httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/download/n/1.0.0", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/packages", nil))
+	var packages []*RemotePackageMetadata
+	if err := json.Unmarshal(rec.Body.Bytes(), &packages); err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, p := range packages {
+		names[p.GroupAndName()] = true
+	}
+	if len(packages) != 2 || !names["n"] || !names["g/h/m"] {
+		t.Fatalf("unexpected packages: %v", names)
+	}
+}
+
+func TestDirectoryPackageGroup(t *testing.T) {
+	for _, test := range []struct {
+		rel, name, group string
+	}{
+		{"n-1.0.0.upack", "n", ""},
+		{"a/b/n-1.0.0.upack", "n", "a/b"},
+		{"packageCache/$n/n.1.0.0.upack", "n", ""},
+		{"packageCache/a$b$N/n.1.0.0.upack", "n", "a/b"},
+		{"packageCache/other/n.1.0.0.upack", "n", "packageCache/other"},
+	} {
+		if group := directoryPackageGroup(test.rel, test.name); group != test.group {
+			t.Errorf("%s: group = %q, want %q", test.rel, group, test.group)
+		}
+	}
+}
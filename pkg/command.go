@@ -2,16 +2,16 @@ package pkg
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -56,7 +56,14 @@ func (a PositionalArgument) Help() string {
 }
 
 func (a ExtraArgument) Help() string {
-	return a.Name + " - " + a.Description
+	name := a.Name
+	for _, alias := range a.Alias {
+		//单字母的别名可以作为短参数使用,如-f plugins.json
+		if len(alias) == 1 {
+			name += ", -" + alias
+		}
+	}
+	return name + " - " + a.Description
 }
 
 func TrySetBoolValue(name string, f func(Command) *bool) func(Command, *string) bool {
@@ -102,6 +109,23 @@ func TrySetStringFnValue(name string, f func(Command) func(string)) func(Command
 	}
 }
 
+func TrySetIntValue(name string, f func(Command) *int) func(Command, *string) bool {
+	return func(cmd Command, value *string) bool {
+		if value == nil {
+			return false
+		}
+
+		i, err := strconv.Atoi(*value)
+		if err != nil {
+			fmt.Println("--"+name, "must be an integer.")
+			return false
+		}
+
+		*f(cmd) = i
+		return true
+	}
+}
+
 func TrySetPathValue(name string, f func(Command) *string) func(Command, *string) bool {
 	return func(cmd Command, value *string) bool {
 		if value == nil {
@@ -228,11 +252,16 @@ func PrintManifest(info *UniversalPackageMetadata) {
 }
 
 func UnpackZip(targetDirectory string, overwrite bool, zipFile *zip.Reader, preserveTimestamps bool) error {
+	return UnpackZipWithProgress(targetDirectory, overwrite, zipFile, preserveTimestamps, nil)
+}
+
+// 与UnpackZip相同,解压的文件数会通知给progress
+func UnpackZipWithProgress(targetDirectory string, overwrite bool, zipFile *zip.Reader, preserveTimestamps bool, progress ProgressReporter) error {
 	var err error
 	if overwrite && len(targetDirectory) > 0 {
 		err = os.RemoveAll(targetDirectory)
 		if err != nil {
-			fmt.Println(err.Error())
+			ReportMessage(progress, ProgressExtract, targetDirectory, err.Error())
 		}
 	}
 	if len(targetDirectory) > 0 {
@@ -242,10 +271,18 @@ func UnpackZip(targetDirectory string, overwrite bool, zipFile *zip.Reader, pres
 		}
 	}
 
-	fmt.Println("extract to", targetDirectory, ", please waitting...")
+	ReportMessage(progress, ProgressExtract, targetDirectory, "extract to "+targetDirectory+" , please waitting...")
 	var files int
 	var directories int
 
+	var totalFiles int64
+	for _, entry := range zipFile.File {
+		if strings.HasPrefix(strings.ToLower(entry.Name), "package/") && !entry.Mode().IsDir() {
+			totalFiles++
+		}
+	}
+	tracker := NewProgressTracker(progress, ProgressExtract, targetDirectory, totalFiles)
+
 	for _, entry := range zipFile.File {
 		if !strings.HasPrefix(strings.ToLower(entry.Name), "package/") {
 			continue
@@ -282,10 +319,12 @@ func UnpackZip(targetDirectory string, overwrite bool, zipFile *zip.Reader, pres
 			}
 
 			files++
+			tracker.Add(1)
 		}
 	}
+	tracker.Done()
 
-	fmt.Println("Extracted", files, "files and", directories, "directories.")
+	ReportMessage(progress, ProgressExtract, targetDirectory, fmt.Sprintf("Extracted %d files and %d directories.", files, directories))
 	return nil
 }
 
@@ -429,57 +468,23 @@ func AddDirectory(zipFile *zip.Writer, sourceDirectory, entryRootPath string) (e
 }
 
 func GetVersion(source, group, name, version string, credentials *[2]string, prerelease bool) (string, error) {
-	if version != "" && !strings.EqualFold(version, "latest") && !prerelease {
-		return version, nil
-	}
-
-	req, err := http.NewRequest("GET", strings.TrimRight(source, "/")+"/packages?"+(url.Values{"group": {group}, "name": {name}}).Encode(), nil)
-	if err != nil {
-		return "", err
-	}
-
-	if credentials != nil {
-		req.SetBasicAuth(credentials[0], credentials[1])
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("ProGet returned HTTP error: %s", resp.Status)
-	}
+	return NewFeedClient(source, credentials).GetLatestVersion(context.Background(), group, name, version, prerelease)
+}
 
-	var data RemotePackageMetadata
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return "", err
-	}
-
-	if len(data.Versions) == 0 {
-		groupAndName := name
-		if group != "" {
-			groupAndName = group + "/" + name
-		}
-		return "", fmt.Errorf("no versions of package %s found", groupAndName)
+func groupAndName(group, name string) string {
+	if group != "" {
+		return group + "/" + name
 	}
+	return name
+}
 
-	var latestVersion *UniversalPackageVersion
-	for _, v := range data.Versions {
-		version, err := ParseUniversalPackageVersion(v)
-		if err != nil {
-			return "", err
-		}
-		if !prerelease && version.Prerelease != "" {
-			continue
-		}
-		if latestVersion == nil || latestVersion.Compare(version) < 0 {
-			latestVersion = version
-		}
+// 将 所属组/名称 格式的字符串拆分为组与名称,也支持使用:分隔
+func SplitGroupAndName(packageName string) (group, name string) {
+	parts := strings.Split(strings.Replace(packageName, ":", "/", -1), "/")
+	if len(parts) == 1 {
+		return "", parts[0]
 	}
-	return latestVersion.String(), nil
+	return strings.Join(parts[:len(parts)-1], "/"), parts[len(parts)-1]
 }
 
 func GetSHA1(filePath string) (h string, err error) {
@@ -551,6 +556,19 @@ func findChars(s string, f func(rune) bool) []string {
 	return chars
 }
 
+// 组用作目录feed中的子目录,不能包含空的、"."或".."路径段
+func validateGroupSegments(group string) error {
+	if group == "" {
+		return nil
+	}
+	for _, segment := range strings.Split(group, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return errors.New("group must not contain empty, '.' or '..' segments.")
+		}
+	}
+	return nil
+}
+
 func ValidateManifest(info *UniversalPackageMetadata) error {
 	if info.Group() != "" {
 		if len(info.Group()) > 250 {
@@ -569,6 +587,10 @@ func ValidateManifest(info *UniversalPackageMetadata) error {
 		if strings.HasPrefix(info.Group(), "/") || strings.HasSuffix(info.Group(), "/") {
 			return errors.New("group must not start or end with a slash.")
 		}
+
+		if err := validateGroupSegments(info.Group()); err != nil {
+			return err
+		}
 	}
 
 	{
@@ -598,5 +620,15 @@ func ValidateManifest(info *UniversalPackageMetadata) error {
 		return errors.New("title must be between 0 and 50 characters long.")
 	}
 
+	if _, err := info.Hooks(); err != nil {
+		return err
+	}
+
+	if requirement := info.HostRequirement(); requirement != "" {
+		if _, err := ParseVersionConstraint(requirement); err != nil {
+			return errors.Wrap(err, "requires.host")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,495 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 按feed地址保存的凭据
+type CredentialStore interface {
+	// 读取feed的认证设置,没有保存凭据时返回nil
+	Get(feedURL string) (*AuthOptions, error)
+	Store(feedURL string, options AuthOptions) error
+	Erase(feedURL string) error
+}
+
+// netrc格式的凭据文件,machine为feed地址(也可以是主机名,匹配该主机上的所有feed):
+//
+//	machine http://proget:8624/upack/plugins/
+//	  login api
+//	  password xxx
+//	  authtype apikey
+//
+// authtype为apikey或bearer时password为api key或token;文件权限必须为0600
+type CredentialFile struct {
+	Path string
+}
+
+type credentialEntry struct {
+	Machine  string
+	Login    string
+	Password string
+	AuthType string
+	// default项,读取时忽略,保存时保留
+	Default bool
+}
+
+func (e *credentialEntry) options() *AuthOptions {
+	options := &AuthOptions{Type: e.AuthType}
+	switch strings.ToLower(e.AuthType) {
+	case AuthTypeAPIKey:
+		options.APIKey = e.Password
+	case AuthTypeBearer:
+		options.Token = e.Password
+	default:
+		if e.Login == "" {
+			options.APIKey = e.Password
+		} else {
+			options.Username = e.Login
+			options.Password = e.Password
+		}
+	}
+	return options
+}
+
+func newCredentialEntry(machine string, options AuthOptions) (*credentialEntry, error) {
+	authType := strings.ToLower(options.Type)
+	if authType == "" && options.Token != "" {
+		authType = AuthTypeBearer
+	}
+	entry := &credentialEntry{Machine: machine, AuthType: authType}
+	switch authType {
+	case "", AuthTypeBasic:
+		entry.Login, entry.Password = options.Username, options.Password
+		if entry.Login == "" {
+			entry.Login, entry.Password = "api", options.APIKey
+		}
+	case AuthTypeAPIKey:
+		entry.Password = options.APIKey
+	case AuthTypeBearer:
+		entry.Password = options.Token
+	default:
+		return nil, errors.Errorf("unknown authentication type '%s'", options.Type)
+	}
+	if entry.Password == "" {
+		return nil, errors.New("secret is empty")
+	}
+	for _, value := range []string{entry.Machine, entry.Login, entry.Password} {
+		if strings.ContainsAny(value, " \t\r\n") {
+			return nil, errors.New("credential file does not support values containing whitespace")
+		}
+	}
+	return entry, nil
+}
+
+// 凭据中包含密码,其它用户可以读取时拒绝使用
+func checkCredentialFilePermission(path string, mode fs.FileMode) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if mode.Perm()&0077 != 0 {
+		return errors.Errorf("credential file %s is accessible by other users (mode %04o), run chmod 600 %s", path, mode.Perm(), path)
+	}
+	return nil
+}
+
+func (f CredentialFile) read() ([]*credentialEntry, error) {
+	if f.Path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCredentialFilePermission(f.Path, fi.Mode()); err != nil {
+		return nil, err
+	}
+
+	var entries []*credentialEntry
+	var current *credentialEntry
+	inMacro := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inMacro {
+			//macdef的内容到空行结束
+			inMacro = line != ""
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			key := fields[i]
+			if key == "default" {
+				current = &credentialEntry{Default: true}
+				entries = append(entries, current)
+				continue
+			}
+			if key == "macdef" {
+				inMacro = true
+				break
+			}
+			if i+1 >= len(fields) {
+				return nil, errors.Errorf("%s: missing value for '%s'", f.Path, key)
+			}
+			i++
+			value := fields[i]
+			if key == "machine" {
+				current = &credentialEntry{Machine: value}
+				entries = append(entries, current)
+				continue
+			}
+			if current == nil {
+				return nil, errors.Errorf("%s: '%s' before machine", f.Path, key)
+			}
+			switch key {
+			case "login":
+				current.Login = value
+			case "password":
+				current.Password = value
+			case "authtype":
+				current.AuthType = strings.ToLower(value)
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (f CredentialFile) write(entries []*credentialEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		if entry.Default {
+			buf.WriteString("default\n")
+		} else {
+			fmt.Fprintf(&buf, "machine %s\n", entry.Machine)
+		}
+		if entry.Login != "" {
+			fmt.Fprintf(&buf, "  login %s\n", entry.Login)
+		}
+		if entry.Password != "" {
+			fmt.Fprintf(&buf, "  password %s\n", entry.Password)
+		}
+		if entry.AuthType != "" {
+			fmt.Fprintf(&buf, "  authtype %s\n", entry.AuthType)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+func normalizeCredentialURL(u string) string {
+	return strings.ToLower(strings.TrimRight(u, "/")) + "/"
+}
+
+// 判断地址u是否为feedURL或其下的地址:协议与主机必须相同,路径按/分隔的段匹配,
+// 用于决定是否向该地址发送feed的认证信息
+func IsFeedURL(feedURL, u string) bool {
+	feed, err := url.Parse(feedURL)
+	if err != nil || feed.Host == "" {
+		return false
+	}
+	target, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(feed.Scheme, target.Scheme) || !strings.EqualFold(feed.Host, target.Host) || target.User != nil {
+		return false
+	}
+	return strings.HasPrefix(normalizeCredentialURL(target.Path), normalizeCredentialURL(feed.Path))
+}
+
+// 查找feed地址对应的凭据:优先使用前缀最长的地址,其次使用主机名相同的项
+func findCredentialEntry(entries []*credentialEntry, feedURL string) *credentialEntry {
+	target := normalizeCredentialURL(feedURL)
+	var host, hostname string
+	if u, err := url.Parse(feedURL); err == nil {
+		host, hostname = strings.ToLower(u.Host), strings.ToLower(u.Hostname())
+	}
+
+	var best, byHost *credentialEntry
+	for _, entry := range entries {
+		if entry.Default {
+			continue
+		}
+		if strings.Contains(entry.Machine, "://") {
+			machine := normalizeCredentialURL(entry.Machine)
+			if strings.HasPrefix(target, machine) && (best == nil || len(machine) > len(normalizeCredentialURL(best.Machine))) {
+				best = entry
+			}
+			continue
+		}
+		machine := strings.ToLower(entry.Machine)
+		if host != "" && (machine == host || (machine == hostname && byHost == nil)) {
+			byHost = entry
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return byHost
+}
+
+func (f CredentialFile) Get(feedURL string) (*AuthOptions, error) {
+	entries, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	entry := findCredentialEntry(entries, feedURL)
+	if entry == nil {
+		return nil, nil
+	}
+	return entry.options(), nil
+}
+
+func (f CredentialFile) Store(feedURL string, options AuthOptions) error {
+	if f.Path == "" {
+		return errors.New("credential file path is empty")
+	}
+	entry, err := newCredentialEntry(feedURL, options)
+	if err != nil {
+		return err
+	}
+	entries, err := f.read()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i, e := range entries {
+		if !e.Default && normalizeCredentialURL(e.Machine) == normalizeCredentialURL(feedURL) {
+			entries[i] = entry
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		entries = append(entries, entry)
+	}
+	return f.write(entries)
+}
+
+func (f CredentialFile) Erase(feedURL string) error {
+	entries, err := f.read()
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Default || normalizeCredentialURL(e.Machine) != normalizeCredentialURL(feedURL) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+	return f.write(kept)
+}
+
+// 执行外部程序读取与保存凭据:«Command» get|store|erase,标准输入为json格式的请求,
+// get时标准输出为json格式的凭据,没有凭据时输出为空.
+// Command按空白分隔为程序与参数,包含空格的路径或参数用双引号或单引号括起来,如"C:\Program Files\helper.exe" --vault
+type CredentialHelper struct {
+	Command string
+	// 为0时使用DefaultCredentialHelperTimeout
+	Timeout time.Duration
+}
+
+const DefaultCredentialHelperTimeout = 30 * time.Second
+
+// 与凭据程序交换的json
+type credentialHelperMessage struct {
+	FeedURL   string `json:"feedUrl"`
+	AuthType  string `json:"authType,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	APIKey    string `json:"apiKey,omitempty"`
+	Token     string `json:"token,omitempty"`
+	TokenEnv  string `json:"tokenEnv,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+func (h CredentialHelper) run(action string, message credentialHelperMessage) ([]byte, error) {
+	args, err := splitCommandLine(h.Command)
+	if err != nil {
+		return nil, errors.Wrapf(err, "credential helper '%s'", h.Command)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("credential helper is empty")
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCredentialHelperTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	input, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], action)...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "credential helper '%s %s'", h.Command, action)
+	}
+	return output, nil
+}
+
+// 按空白分隔命令行,双引号或单引号中的内容作为一个参数的一部分;
+// 反斜杠不作为转义字符,Windows路径可以直接使用
+func splitCommandLine(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func (h CredentialHelper) Get(feedURL string) (*AuthOptions, error) {
+	output, err := h.run("get", credentialHelperMessage{FeedURL: feedURL})
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil, nil
+	}
+	var message credentialHelperMessage
+	if err = json.Unmarshal(output, &message); err != nil {
+		return nil, errors.Wrapf(err, "credential helper '%s get' returned invalid json", h.Command)
+	}
+	return &AuthOptions{
+		Type:      message.AuthType,
+		Username:  message.Username,
+		Password:  message.Password,
+		APIKey:    message.APIKey,
+		Token:     message.Token,
+		TokenEnv:  message.TokenEnv,
+		TokenFile: message.TokenFile,
+	}, nil
+}
+
+func (h CredentialHelper) Store(feedURL string, options AuthOptions) error {
+	_, err := h.run("store", credentialHelperMessage{
+		FeedURL:   feedURL,
+		AuthType:  options.Type,
+		Username:  options.Username,
+		Password:  options.Password,
+		APIKey:    options.APIKey,
+		Token:     options.Token,
+		TokenEnv:  options.TokenEnv,
+		TokenFile: options.TokenFile,
+	})
+	return err
+}
+
+func (h CredentialHelper) Erase(feedURL string) error {
+	_, err := h.run("erase", credentialHelperMessage{FeedURL: feedURL})
+	return err
+}
+
+// 在第一次请求时从CredentialStore读取feed的凭据,没有凭据时不添加认证信息
+type CredentialAuthenticator struct {
+	Store   CredentialStore
+	FeedURL string
+
+	once          sync.Once
+	authenticator Authenticator
+	err           error
+}
+
+func NewCredentialAuthenticator(store CredentialStore, feedURL string) *CredentialAuthenticator {
+	return &CredentialAuthenticator{Store: store, FeedURL: feedURL}
+}
+
+func (a *CredentialAuthenticator) Authenticate(req *http.Request) error {
+	a.once.Do(func() {
+		options, err := a.Store.Get(a.FeedURL)
+		if err != nil {
+			a.err = errors.Wrap(err, "reading credentials")
+			return
+		}
+		if options != nil {
+			a.authenticator, a.err = NewAuthenticator(*options)
+			a.err = errors.Wrapf(a.err, "invalid credentials for %s", a.FeedURL)
+		}
+	})
+	if a.err != nil {
+		return a.err
+	}
+	if a.authenticator == nil {
+		return nil
+	}
+	return a.authenticator.Authenticate(req)
+}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIsFeedURL(t *testing.T) {
+	tests := []struct {
+		feedURL, u string
+		want       bool
+	}{
+		{"https://proget.example.com", "https://proget.example.com/upack/plugins/download/g/n/1.0.0", true},
+		{"https://proget.example.com/", "https://PROGET.example.com/x.upack", true},
+		{"https://proget.example.com/upack", "https://proget.example.com/upack/plugins/x.upack", true},
+		{"https://proget.example.com/upack/", "https://proget.example.com/upack", true},
+		{"https://proget.example.com", "https://proget.example.com.evil.net/x.upack", false},
+		{"https://proget.example.com", "https://proget.example.com@evil.net/x.upack", false},
+		{"https://proget.example.com", "http://proget.example.com/x.upack", false},
+		{"https://proget.example.com:8624", "https://proget.example.com/x.upack", false},
+		{"https://proget.example.com/upack", "https://proget.example.com/upack-evil/x.upack", false},
+		{"", "https://proget.example.com/x.upack", false},
+	}
+	for _, test := range tests {
+		if got := IsFeedURL(test.feedURL, test.u); got != test.want {
+			t.Errorf("IsFeedURL(%q, %q) = %v, want %v", test.feedURL, test.u, got, test.want)
+		}
+	}
+}
+
+func writeCredentialFile(t *testing.T, content string) CredentialFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return CredentialFile{Path: path}
+}
+
+func TestCredentialFileGet(t *testing.T) {
+	f := writeCredentialFile(t, `# 注释
+machine proget.example.com login host password host-secret
+machine proget.example.com:8624
+  login port
+  password port-secret
+macdef init
+  machine http://proget.example.com/upack/ login macro password macro-secret
+
+machine http://proget.example.com/upack/
+  password upack-key
+  authtype apikey
+machine http://proget.example.com/upack/plugins/
+  password plugins-token
+  authtype bearer
+default login anonymous password default-secret
+`)
+	for _, test := range []struct {
+		feedURL string
+		want    AuthOptions
+		none    bool
+	}{
+		// 前缀最长的地址优先
+		{"http://proget.example.com/upack/plugins/", AuthOptions{Type: AuthTypeBearer, Token: "plugins-token"}, false},
+		{"http://proget.example.com/upack/plugins-test/", AuthOptions{Type: AuthTypeAPIKey, APIKey: "upack-key"}, false},
+		{"http://PROGET.example.com/upack/other", AuthOptions{Type: AuthTypeAPIKey, APIKey: "upack-key"}, false},
+		// 地址都不匹配时使用主机名,带端口的主机优先
+		{"https://proget.example.com/upack/plugins/", AuthOptions{Username: "host", Password: "host-secret"}, false},
+		{"http://proget.example.com:8624/upack/plugins/", AuthOptions{Username: "port", Password: "port-secret"}, false},
+		// default项被忽略
+		{"http://other.example.com/upack/plugins/", AuthOptions{}, true},
+	} {
+		options, err := f.Get(test.feedURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.none {
+			if options != nil {
+				t.Errorf("%s: expected no credentials, got %+v", test.feedURL, options)
+			}
+			continue
+		}
+		if options == nil || *options != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.feedURL, options, test.want)
+		}
+	}
+}
+
+func TestCredentialFileRejectsUnsafePermission(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on windows")
+	}
+	f := writeCredentialFile(t, "machine proget.example.com login api password secret\n")
+	if err := os.Chmod(f.Path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Get("http://proget.example.com/upack/plugins/"); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Fatalf("expected permission error, got %v", err)
+	}
+}
+
+func TestCredentialFileStoreErase(t *testing.T) {
+	f := writeCredentialFile(t, "default login anonymous password default-secret\n")
+	feedURL := "http://proget.example.com/upack/plugins/"
+	for _, options := range []AuthOptions{
+		{APIKey: "key"},
+		{Username: "user", Password: "secret"},
+		{Type: AuthTypeBearer, Token: "token"},
+	} {
+		if err := f.Store(feedURL, options); err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Get(strings.TrimSuffix(feedURL, "/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := options
+		if want.APIKey != "" {
+			//没有用户名的api key保存为login api
+			want = AuthOptions{Username: "api", Password: "key"}
+		}
+		if got == nil || *got != want {
+			t.Errorf("stored %+v, read %+v", options, got)
+		}
+	}
+	if err := f.Store("http://proget.example.com/upack/other/", AuthOptions{APIKey: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		if fi, err := os.Stat(f.Path); err != nil || fi.Mode().Perm() != 0600 {
+			t.Fatalf("credential file mode: %v, %v", fi.Mode(), err)
+		}
+	}
+
+	if err := f.Erase(feedURL); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := f.Get(feedURL); err != nil || got != nil {
+		t.Fatalf("credentials were not erased: %+v, %v", got, err)
+	}
+	entries, err := f.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !entries[0].Default || entries[1].Machine != "http://proget.example.com/upack/other/" {
+		t.Fatalf("unexpected entries after erase: %+v", entries)
+	}
+	if err = f.Store(feedURL, AuthOptions{Username: "user", Password: "with space"}); err == nil {
+		t.Fatal("expected an error for a password containing whitespace")
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	//程序路径中包含空格
+	dir := filepath.Join(t.TempDir(), "credential helper")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "requests.log")
+	script := filepath.Join(dir, "helper.sh")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+input=$(cat)
+echo "$1 $2 $input" >> "`+log+`"
+if [ "$2" = get ]; then
+  case "$input" in
+    *plugins*) echo '{"authType":"apikey","apiKey":"helper-key"}' ;;
+  esac
+fi
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := CredentialHelper{Command: `"` + script + `" 'vault name'`}
+
+	options, err := h.Get("http://proget.example.com/upack/plugins/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options == nil || *options != (AuthOptions{Type: AuthTypeAPIKey, APIKey: "helper-key"}) {
+		t.Fatalf("get returned %+v", options)
+	}
+	if options, err = h.Get("http://proget.example.com/upack/other/"); err != nil || options != nil {
+		t.Fatalf("expected no credentials, got %+v, %v", options, err)
+	}
+	if err = h.Store("http://proget.example.com/upack/plugins/", AuthOptions{Type: AuthTypeBearer, Token: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Erase("http://proget.example.com/upack/plugins/"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`vault name get {"feedUrl":"http://proget.example.com/upack/plugins/"}`,
+		`vault name get {"feedUrl":"http://proget.example.com/upack/other/"}`,
+		`vault name store {"feedUrl":"http://proget.example.com/upack/plugins/","authType":"bearer","token":"t"}`,
+		`vault name erase {"feedUrl":"http://proget.example.com/upack/plugins/"}`,
+	}
+	if got := strings.Split(strings.TrimSpace(string(data)), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("helper received:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	h.Command = `"` + script
+	if _, err = h.Get("http://proget.example.com/upack/plugins/"); err == nil || !strings.Contains(err.Error(), "unterminated") {
+		t.Fatalf("expected unterminated quote error, got %v", err)
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		args    []string
+	}{
+		{"", nil},
+		{"  helper  get ", []string{"helper", "get"}},
+		{`"C:\Program Files\helper.exe" --vault`, []string{`C:\Program Files\helper.exe`, "--vault"}},
+		{`/opt/my\ helper`, []string{`/opt/my\`, "helper"}},
+		{`helper --name='a "b" c' x""y`, []string{"helper", `--name=a "b" c`, "xy"}},
+		{`helper ""`, []string{"helper", ""}},
+	} {
+		args, err := splitCommandLine(test.command)
+		if err != nil {
+			t.Errorf("%s: %v", test.command, err)
+			continue
+		}
+		if strings.Join(args, "|") != strings.Join(test.args, "|") || len(args) != len(test.args) {
+			t.Errorf("splitCommandLine(%s) = %q, want %q", test.command, args, test.args)
+		}
+	}
+}
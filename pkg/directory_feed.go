@@ -0,0 +1,775 @@
+package pkg
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 目录中保存模块信息索引的文件,避免每次请求都重新读取所有模块包
+const DirectoryFeedIndexFileName = ".upack-index.json"
+
+// 上传模块包的默认最大长度
+const DefaultMaxUploadSize = 2 << 30
+
+// 以本地目录作为模块仓储,目录及其子目录中的每个.upack文件为一个模块版本,
+// 模块的组、名称与版本来自包中的upack.json,upack.json中没有组时使用所在的子目录.
+// 实现了与ProGet相同的universal feed api,既可以由FeedClient直接访问,也可以作为http服务提供
+type DirectoryFeed struct {
+	Root string
+	//上传模块包的最大长度,为0时使用DefaultMaxUploadSize
+	MaxUploadSize int64
+
+	mu sync.Mutex
+	//扫描目录后整体替换,读取时不需要加锁
+	index directoryIndexMap
+
+	//未完成的分块上传,按上传id索引
+	uploadsMu sync.Mutex
+	uploads   map[string]*multipartUpload
+}
+
+// 按相对路径索引的模块包信息
+type directoryIndexMap map[string]*directoryIndexEntry
+
+type directoryIndexEntry struct {
+	RemotePackageVersion
+	// 相对于Root的路径,使用/分隔
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+	// 无法读取时的错误信息,文件修改之前不再重复读取
+	Invalid string `json:"invalid,omitempty"`
+}
+
+type directoryIndex struct {
+	Packages []*directoryIndexEntry `json:"packages"`
+}
+
+func NewDirectoryFeed(root string) *DirectoryFeed {
+	return &DirectoryFeed{Root: root}
+}
+
+// 同一进程中访问同一目录的FeedClient共享索引
+var _directoryFeeds sync.Map
+
+func getDirectoryFeed(root string) *DirectoryFeed {
+	if feed, ok := _directoryFeeds.Load(root); ok {
+		return feed.(*DirectoryFeed)
+	}
+	//本地命令直接写入目录,不限制模块包的长度
+	directoryFeed := NewDirectoryFeed(root)
+	directoryFeed.MaxUploadSize = math.MaxInt64
+	feed, _ := _directoryFeeds.LoadOrStore(root, directoryFeed)
+	return feed.(*DirectoryFeed)
+}
+
+// 判断feed地址是否为本地目录(file://地址或者不带协议的路径),返回目录的绝对路径
+func DirectoryFeedRoot(feedURL string) (string, bool) {
+	if len(feedURL) <= 0 {
+		return "", false
+	}
+	if strings.HasPrefix(strings.ToLower(feedURL), "file://") {
+		u, err := url.Parse(feedURL)
+		if err != nil {
+			return "", false
+		}
+		p := u.Path
+		if len(u.Host) > 0 && !strings.EqualFold(u.Host, "localhost") {
+			//file://server/share形式的UNC路径
+			p = "//" + u.Host + p
+		} else if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+			//file:///C:/upacks
+			p = p[1:]
+		}
+		return filepath.Clean(filepath.FromSlash(p)), true
+	}
+	if strings.Contains(feedURL, "://") {
+		return "", false
+	}
+	root, err := filepath.Abs(feedURL)
+	if err != nil {
+		return "", false
+	}
+	return root, true
+}
+
+// 重新扫描目录,只读取新增或修改过的模块包,索引有变化时保存索引文件,调用时需要持有锁
+func (d *DirectoryFeed) refresh() error {
+	if d.index == nil {
+		d.index = d.loadIndex()
+	}
+
+	index := make(directoryIndexMap, len(d.index))
+	changed := false
+	seen := make(map[string]bool)
+	err := filepath.Walk(d.Root, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(fi.Name(), ".") && filePath != d.Root {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || !strings.EqualFold(filepath.Ext(fi.Name()), ".upack") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Root, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		entry := d.index[rel]
+		if entry != nil && entry.Size == fi.Size() && entry.ModTime.Equal(fi.ModTime()) {
+			index[rel] = entry
+			return nil
+		}
+		entry, err = readDirectoryIndexEntry(filePath, rel, fi)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			entry = &directoryIndexEntry{Path: rel, ModTime: fi.ModTime(), Invalid: err.Error()}
+			entry.Size = fi.Size()
+		}
+		index[rel] = entry
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for rel := range d.index {
+		if !seen[rel] {
+			changed = true
+		}
+	}
+	d.index = index
+	if changed {
+		//只读目录(如光盘)中无法保存索引,不影响使用
+		_ = d.saveIndex()
+	}
+	return nil
+}
+
+func (d *DirectoryFeed) loadIndex() directoryIndexMap {
+	result := make(directoryIndexMap)
+	data, err := os.ReadFile(filepath.Join(d.Root, DirectoryFeedIndexFileName))
+	if err != nil {
+		return result
+	}
+	var index directoryIndex
+	if json.Unmarshal(data, &index) != nil {
+		return result
+	}
+	for _, entry := range index.Packages {
+		//之前的版本把缓存目录作为组保存在索引中,重新读取这些模块包
+		if strings.HasPrefix(entry.Group, directoryFeedCacheDirectory+"/") {
+			continue
+		}
+		result[entry.Path] = entry
+	}
+	return result
+}
+
+// 重新扫描目录并返回最新的索引
+func (d *DirectoryFeed) snapshot() (directoryIndexMap, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.refresh()
+	return d.index, err
+}
+
+func (d *DirectoryFeed) saveIndex() error {
+	index := directoryIndex{Packages: make([]*directoryIndexEntry, 0, len(d.index))}
+	for _, entry := range d.index {
+		index.Packages = append(index.Packages, entry)
+	}
+	sort.Slice(index.Packages, func(a, b int) bool {
+		return index.Packages[a].Path < index.Packages[b].Path
+	})
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(d.Root, DirectoryFeedIndexFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filepath.Join(d.Root, DirectoryFeedIndexFileName))
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
+// 读取模块包中的upack.json并计算哈希值
+func readDirectoryIndexEntry(filePath, rel string, fi os.FileInfo) (*directoryIndexEntry, error) {
+	metadata, err := readPackageFileManifest(filePath)
+	if err != nil {
+		return nil, err
+	}
+	version, err := ParseUniversalPackageVersion(metadata.Version())
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sha1Hash, sha256Hash := sha1.New(), sha256.New()
+	_, err = io.Copy(io.MultiWriter(sha1Hash, sha256Hash), f)
+	if err != nil {
+		return nil, err
+	}
+
+	group := metadata.Group()
+	if len(group) <= 0 {
+		group = directoryPackageGroup(rel, metadata.Name())
+	}
+	return &directoryIndexEntry{
+		RemotePackageVersion: RemotePackageVersion{
+			Group:        group,
+			Name:         metadata.Name(),
+			Version:      version.String(),
+			Title:        metadata.Title(),
+			Description:  metadata.Description(),
+			Icon:         metadata.IconURL(),
+			Published:    fi.ModTime().UTC().Format(time.RFC3339),
+			Size:         fi.Size(),
+			SHA1:         hex.EncodeToString(sha1Hash.Sum(nil)),
+			SHA256:       hex.EncodeToString(sha256Hash.Sum(nil)),
+			Dependencies: metadata.Dependencies(),
+		},
+		Path:    rel,
+		ModTime: fi.ModTime(),
+	}, nil
+}
+
+// CachingFeed按照Registry的缓存目录结构保存模块包的目录
+const directoryFeedCacheDirectory = "packageCache"
+
+// upack.json中没有组时使用所在的子目录;packageCache/«组$名称»/中的模块包从目录名中解析组
+func directoryPackageGroup(rel, name string) string {
+	dir := path.Dir(rel)
+	if dir == "." {
+		return ""
+	}
+	parent, base := path.Split(dir)
+	suffix := "$" + name
+	if parent == directoryFeedCacheDirectory+"/" && len(base) >= len(suffix) && strings.EqualFold(base[len(base)-len(suffix):], suffix) {
+		return strings.Replace(base[:len(base)-len(suffix)], "$", "/", -1)
+	}
+	return dir
+}
+
+func readPackageFileManifest(filePath string) (*UniversalPackageMetadata, error) {
+	zipFile, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zipFile.Close()
+
+	for _, entry := range zipFile.File {
+		if entry.Name == "upack.json" {
+			r, err := entry.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return ReadManifest(r)
+		}
+	}
+	return nil, fmt.Errorf("upack.json not found")
+}
+
+// 查找指定模块的所有版本,按版本号从高到低排序
+func (index directoryIndexMap) findVersions(group, name string) []*directoryIndexEntry {
+	var result []*directoryIndexEntry
+	for _, entry := range index {
+		if entry.Invalid == "" && strings.EqualFold(entry.Group, group) && strings.EqualFold(entry.Name, name) {
+			result = append(result, entry)
+		}
+	}
+	sortDirectoryEntries(result)
+	return result
+}
+
+func sortDirectoryEntries(entries []*directoryIndexEntry) {
+	sort.SliceStable(entries, func(a, b int) bool {
+		if !strings.EqualFold(entries[a].GroupAndName(), entries[b].GroupAndName()) {
+			return strings.ToLower(entries[a].GroupAndName()) < strings.ToLower(entries[b].GroupAndName())
+		}
+		va, _ := ParseUniversalPackageVersion(entries[a].Version)
+		vb, _ := ParseUniversalPackageVersion(entries[b].Version)
+		return va.Compare(vb) > 0
+	})
+}
+
+// 查找指定版本,version为空时返回最新版本
+func (index directoryIndexMap) findVersion(group, name, version string) *directoryIndexEntry {
+	versions := index.findVersions(group, name)
+	if len(versions) <= 0 {
+		return nil
+	}
+	if len(version) <= 0 {
+		return versions[0]
+	}
+	v, err := ParseUniversalPackageVersion(version)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range versions {
+		if entry.Version == v.String() {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (d *DirectoryFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	index, err := d.snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	segments := feedPathSegments(r)
+	query := r.URL.Query()
+	_, latest := query["latest"]
+
+	switch {
+	case r.Method == http.MethodGet && segments[0] == "packages":
+		d.servePackages(w, index, query.Get("group"), query.Get("name"))
+	case r.Method == http.MethodGet && segments[0] == "versions":
+		d.serveVersions(w, index, query.Get("group"), query.Get("name"), query.Get("version"))
+	case r.Method == http.MethodGet && segments[0] == "download":
+		group, name, version, ok := parseDirectoryFeedPackagePath(segments[1:], latest)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		d.serveDownload(w, r, index, group, name, version)
+	case r.Method == http.MethodGet && segments[0] == "download-file":
+		group, name, version, ok := parseDirectoryFeedPackagePath(segments[1:], latest)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		d.serveDownloadFile(w, r, index, group, name, version, query.Get("path"))
+	case (r.Method == http.MethodPut || r.Method == http.MethodPost) && (segments[0] == "" || segments[0] == "upload"):
+		if len(query.Get("id")) > 0 {
+			d.serveMultipartUpload(w, r)
+			return
+		}
+		d.serveUpload(w, r)
+	case r.Method == http.MethodDelete && segments[0] == "delete":
+		group, name, version, ok := parseDirectoryFeedPackagePath(segments[1:], false)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		d.serveDelete(w, group, name, version)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// 拆分请求路径,每一段分别解码,以支持包含/的组
+func feedPathSegments(r *http.Request) []string {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i := range segments {
+		segments[i], _ = url.PathUnescape(segments[i])
+	}
+	return segments
+}
+
+// 解析 组/名称/版本 格式的路径,组可以包含多级,latest为true时路径中没有版本
+func parseDirectoryFeedPackagePath(segments []string, latest bool) (group, name, version string, ok bool) {
+	if !latest {
+		if len(segments) < 2 {
+			return "", "", "", false
+		}
+		version = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+	}
+	if len(segments) < 1 || segments[len(segments)-1] == "" {
+		return "", "", "", false
+	}
+	return strings.Join(segments[:len(segments)-1], "/"), segments[len(segments)-1], version, true
+}
+
+func writeDirectoryFeedJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (d *DirectoryFeed) servePackages(w http.ResponseWriter, index directoryIndexMap, group, name string) {
+	if len(name) > 0 {
+		versions := index.findVersions(group, name)
+		if len(versions) <= 0 {
+			http.Error(w, "package not found", http.StatusNotFound)
+			return
+		}
+		writeDirectoryFeedJSON(w, newDirectoryPackageMetadata(versions))
+		return
+	}
+
+	var entries []*directoryIndexEntry
+	for _, entry := range index {
+		if entry.Invalid == "" && (len(group) <= 0 || strings.EqualFold(entry.Group, group)) {
+			entries = append(entries, entry)
+		}
+	}
+	sortDirectoryEntries(entries)
+	packages := make([]*RemotePackageMetadata, 0)
+	for start := 0; start < len(entries); {
+		end := start + 1
+		for end < len(entries) && strings.EqualFold(entries[end].GroupAndName(), entries[start].GroupAndName()) {
+			end++
+		}
+		packages = append(packages, newDirectoryPackageMetadata(entries[start:end]))
+		start = end
+	}
+	writeDirectoryFeedJSON(w, packages)
+}
+
+// 根据同一模块按版本号从高到低排序的所有版本生成模块信息
+func newDirectoryPackageMetadata(versions []*directoryIndexEntry) *RemotePackageMetadata {
+	latest := versions[0]
+	metadata := &RemotePackageMetadata{
+		Group:         latest.Group,
+		Name:          latest.Name,
+		LatestVersion: latest.Version,
+		Title:         latest.Title,
+		Description:   latest.Description,
+		Icon:          latest.Icon,
+		Versions:      make([]string, 0, len(versions)),
+	}
+	for _, entry := range versions {
+		metadata.Versions = append(metadata.Versions, entry.Version)
+	}
+	return metadata
+}
+
+func (d *DirectoryFeed) serveVersions(w http.ResponseWriter, index directoryIndexMap, group, name, version string) {
+	if len(version) > 0 {
+		entry := index.findVersion(group, name, version)
+		if entry == nil {
+			http.Error(w, "package version not found", http.StatusNotFound)
+			return
+		}
+		writeDirectoryFeedJSON(w, entry.RemotePackageVersion)
+		return
+	}
+
+	var entries []*directoryIndexEntry
+	if len(name) > 0 {
+		entries = index.findVersions(group, name)
+	} else {
+		for _, entry := range index {
+			if entry.Invalid == "" && (len(group) <= 0 || strings.EqualFold(entry.Group, group)) {
+				entries = append(entries, entry)
+			}
+		}
+		sortDirectoryEntries(entries)
+	}
+	versions := make([]RemotePackageVersion, 0, len(entries))
+	for _, entry := range entries {
+		versions = append(versions, entry.RemotePackageVersion)
+	}
+	writeDirectoryFeedJSON(w, versions)
+}
+
+func (d *DirectoryFeed) serveDownload(w http.ResponseWriter, r *http.Request, index directoryIndexMap, group, name, version string) {
+	entry := index.findVersion(group, name, version)
+	if entry == nil {
+		http.Error(w, "package version not found", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(filepath.Join(d.Root, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(entry.Path)))
+	//支持Range请求,用于断点续传
+	http.ServeContent(w, r, "", entry.ModTime, f)
+}
+
+func (d *DirectoryFeed) serveDownloadFile(w http.ResponseWriter, r *http.Request, index directoryIndexMap, group, name, version, filePath string) {
+	entry := index.findVersion(group, name, version)
+	if entry == nil {
+		http.Error(w, "package version not found", http.StatusNotFound)
+		return
+	}
+	zipFile, err := zip.OpenReader(filepath.Join(d.Root, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer zipFile.Close()
+
+	filePath = strings.TrimPrefix(filePath, "/")
+	for _, file := range zipFile.File {
+		if file.Name != filePath {
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = io.Copy(w, content)
+		return
+	}
+	http.Error(w, "file not found in package", http.StatusNotFound)
+}
+
+func (d *DirectoryFeed) maxUploadSize() int64 {
+	if d.MaxUploadSize > 0 {
+		return d.MaxUploadSize
+	}
+	return DefaultMaxUploadSize
+}
+
+func (d *DirectoryFeed) serveUpload(w http.ResponseWriter, r *http.Request) {
+	f, err := os.CreateTemp(d.Root, ".upload-*.tmp")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(f, http.MaxBytesReader(w, r.Body, d.maxUploadSize()))
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("package exceeds the maximum upload size of %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.publishUpload(w, tmpPath)
+}
+
+// 校验上传的模块包并保存到 组/名称-版本.upack,已存在相同版本时返回409
+func (d *DirectoryFeed) publishUpload(w http.ResponseWriter, tmpPath string) {
+	metadata, err := readPackageFileManifest(tmpPath)
+	if err == nil {
+		err = ValidateManifest(metadata)
+	}
+	if err != nil {
+		http.Error(w, "invalid package: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, err := ParseUniversalPackageVersion(metadata.Version())
+	if err == nil {
+		err = validateGroupSegments(metadata.Group())
+	}
+	if err != nil {
+		http.Error(w, "invalid package: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.refresh()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d.index.findVersion(metadata.Group(), metadata.Name(), version.String()) != nil {
+		http.Error(w, fmt.Sprintf("package %s %s already exists", metadata.GroupAndName(), version), http.StatusConflict)
+		return
+	}
+
+	target, err := d.packagePath(path.Join(metadata.Group(), metadata.Name()+"-"+version.String()+".upack"))
+	if err != nil {
+		http.Error(w, "invalid package: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err == nil {
+		err = os.Rename(tmpPath, target)
+	}
+	if err == nil {
+		err = d.refresh()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// 将相对于Root的路径转换为文件路径,拒绝指向Root之外的路径
+func (d *DirectoryFeed) packagePath(rel string) (string, error) {
+	target := filepath.Join(d.Root, filepath.FromSlash(rel))
+	r, err := filepath.Rel(d.Root, target)
+	if err != nil {
+		return "", err
+	}
+	if r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) || filepath.IsAbs(r) {
+		return "", fmt.Errorf("path %s is outside of the feed directory", rel)
+	}
+	return target, nil
+}
+
+func (d *DirectoryFeed) serveDelete(w http.ResponseWriter, group, name, version string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.refresh()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entry := d.index.findVersion(group, name, version)
+	if entry == nil || len(version) <= 0 {
+		http.Error(w, "package version not found", http.StatusNotFound)
+		return
+	}
+	target, err := d.packagePath(entry.Path)
+	if err == nil {
+		err = os.Remove(target)
+	}
+	if err == nil {
+		err = d.refresh()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// 将本地目录转换为file://地址
+func directoryFeedURL(root string) *url.URL {
+	p := filepath.ToSlash(root)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return &url.URL{Scheme: "file", Path: p}
+}
+
+// 在当前进程中调用http.Handler处理请求,用于访问本地目录feed
+type handlerTransport struct {
+	// 请求路径中需要去掉的前缀
+	prefix  string
+	handler http.Handler
+}
+
+func newDirectoryFeedTransport(root string) *handlerTransport {
+	return &handlerTransport{
+		prefix:  directoryFeedURL(root).EscapedPath(),
+		handler: getDirectoryFeed(root),
+	}
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rel := strings.TrimPrefix(req.URL.EscapedPath(), t.prefix)
+	if !strings.HasPrefix(rel, "/") {
+		rel = "/" + rel
+	}
+	u := *req.URL
+	u.RawPath = rel
+	u.Path, _ = url.PathUnescape(rel)
+	r := req.Clone(req.Context())
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{header: make(http.Header), pw: pw, ready: make(chan struct{})}
+	go func() {
+		t.handler.ServeHTTP(w, r)
+		w.WriteHeader(http.StatusOK)
+		_ = pw.Close()
+	}()
+
+	select {
+	case <-w.ready:
+	case <-req.Context().Done():
+		_ = pr.CloseWithError(req.Context().Err())
+		return nil, req.Context().Err()
+	}
+	contentLength := int64(-1)
+	if length := w.sent.Get("Content-Length"); len(length) > 0 {
+		fmt.Sscan(length, &contentLength)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          pr,
+		ContentLength: contentLength,
+		Request:       req,
+	}, nil
+}
+
+// 将响应内容写入管道,WriteHeader之后RoundTrip即可返回
+type pipeResponseWriter struct {
+	header http.Header
+	sent   http.Header
+	status int
+	pw     *io.PipeWriter
+	ready  chan struct{}
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(statusCode int) {
+	if w.sent != nil {
+		return
+	}
+	w.status = statusCode
+	w.sent = w.header.Clone()
+	close(w.ready)
+}
+
+func (w *pipeResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pw.Write(b)
+}
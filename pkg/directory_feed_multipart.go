@@ -0,0 +1,161 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 超过该时间没有收到新的分块时丢弃未完成的上传
+const multipartUploadExpiration = time.Hour
+
+// 分块上传中的模块包,所有分块按offset写入同一个临时文件
+type multipartUpload struct {
+	path       string
+	totalSize  int64
+	totalParts int64
+	received   map[int64]bool
+	updated    time.Time
+}
+
+// 接收FeedClient.uploadChunks上传的分块,multipart=complete时校验并保存模块包
+func (d *DirectoryFeed) serveMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id := query.Get("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "invalid upload id", http.StatusBadRequest)
+		return
+	}
+	if query.Get("multipart") == "complete" {
+		d.completeMultipartUpload(w, id)
+		return
+	}
+
+	var values [4]int64
+	for i, key := range []string{"index", "offset", "totalSize", "totalParts"} {
+		value, err := strconv.ParseInt(query.Get(key), 10, 64)
+		if err != nil || value < 0 {
+			http.Error(w, "invalid "+key, http.StatusBadRequest)
+			return
+		}
+		values[i] = value
+	}
+	index, offset, totalSize, totalParts := values[0], values[1], values[2], values[3]
+	if totalParts <= 0 || index >= totalParts || offset > totalSize {
+		http.Error(w, "invalid upload part", http.StatusBadRequest)
+		return
+	}
+	if totalSize > d.maxUploadSize() {
+		http.Error(w, fmt.Sprintf("package exceeds the maximum upload size of %d bytes", d.maxUploadSize()), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload, err := d.multipartUpload(id, totalSize, totalParts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := os.OpenFile(upload.path, os.O_WRONLY, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	var written int64
+	if err == nil {
+		//多读取一个字节,用于判断分块是否超出模块包的长度
+		written, err = io.Copy(f, io.LimitReader(r.Body, totalSize-offset+1))
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if offset+written > totalSize {
+		http.Error(w, "upload part exceeds total size", http.StatusBadRequest)
+		return
+	}
+
+	d.uploadsMu.Lock()
+	upload.received[index] = true
+	upload.updated = time.Now()
+	d.uploadsMu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// 获取或创建分块上传,同时清理过期的上传
+func (d *DirectoryFeed) multipartUpload(id string, totalSize, totalParts int64) (*multipartUpload, error) {
+	d.uploadsMu.Lock()
+	defer d.uploadsMu.Unlock()
+
+	if upload, ok := d.uploads[id]; ok {
+		if upload.totalSize != totalSize || upload.totalParts != totalParts {
+			return nil, fmt.Errorf("upload %s: totalSize or totalParts changed", id)
+		}
+		return upload, nil
+	}
+
+	if d.uploads == nil {
+		d.uploads = make(map[string]*multipartUpload)
+	}
+	for key, upload := range d.uploads {
+		if time.Since(upload.updated) > multipartUploadExpiration {
+			_ = os.Remove(upload.path)
+			delete(d.uploads, key)
+		}
+	}
+
+	upload := &multipartUpload{
+		path:       filepath.Join(d.Root, ".upload-"+id+".part"),
+		totalSize:  totalSize,
+		totalParts: totalParts,
+		received:   make(map[int64]bool),
+		updated:    time.Now(),
+	}
+	f, err := os.OpenFile(upload.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	d.uploads[id] = upload
+	return upload, nil
+}
+
+func (d *DirectoryFeed) completeMultipartUpload(w http.ResponseWriter, id string) {
+	d.uploadsMu.Lock()
+	upload, ok := d.uploads[id]
+	if ok {
+		delete(d.uploads, id)
+	}
+	d.uploadsMu.Unlock()
+	if !ok {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	defer os.Remove(upload.path)
+
+	if int64(len(upload.received)) != upload.totalParts {
+		http.Error(w, fmt.Sprintf("incomplete upload: received %d of %d parts", len(upload.received), upload.totalParts), http.StatusBadRequest)
+		return
+	}
+	fi, err := os.Stat(upload.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fi.Size() != upload.totalSize {
+		http.Error(w, fmt.Sprintf("incomplete upload: received %d of %d bytes", fi.Size(), upload.totalSize), http.StatusBadRequest)
+		return
+	}
+	d.publishUpload(w, upload.path)
+}
@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 生成只包含upack.json与一个文件的模块包
+func testPackage(t *testing.T, manifest map[string]interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("upack.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.NewEncoder(w).Encode(manifest); err != nil {
+		t.Fatal(err)
+	}
+	w, err = zw.Create("package/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateManifestRejectsGroupTraversal(t *testing.T) {
+	for _, group := range []string{"..", "a/../b", "a/./b", "a//b", "x/../../../tmp"} {
+		info := &UniversalPackageMetadata{"group": group, "name": "n", "version": "1.0.0"}
+		if err := ValidateManifest(info); err == nil {
+			t.Errorf("group %q: expected validation error", group)
+		}
+	}
+	info := &UniversalPackageMetadata{"group": "a.b/c-d", "name": "n", "version": "1.0.0"}
+	if err := ValidateManifest(info); err != nil {
+		t.Errorf("group a.b/c-d: %v", err)
+	}
+}
+
+func TestDirectoryFeedUploadRejectsGroupTraversal(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "feed")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	feed := NewDirectoryFeed(root)
+
+	data := testPackage(t, map[string]interface{}{"group": "x/../../escaped", "name": "n", "version": "1.0.0"})
+	rec := httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(data)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escaped", "n-1.0.0.upack")); !os.IsNotExist(err) {
+		t.Fatalf("package was written outside of the feed directory: %v", err)
+	}
+
+	data = testPackage(t, map[string]interface{}{"group": "x/y", "name": "n", "version": "1.0.0"})
+	rec = httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(data)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "x", "y", "n-1.0.0.upack")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirectoryFeedPackagePath(t *testing.T) {
+	feed := NewDirectoryFeed(t.TempDir())
+	for _, rel := range []string{"../a.upack", "a/../../b.upack", ".."} {
+		if _, err := feed.packagePath(rel); err == nil {
+			t.Errorf("%s: expected error", rel)
+		}
+	}
+	if _, err := feed.packagePath("a/b/c.upack"); err != nil {
+		t.Errorf("a/b/c.upack: %v", err)
+	}
+}
+
+func TestDirectoryFeedUploadSizeLimit(t *testing.T) {
+	feed := NewDirectoryFeed(t.TempDir())
+	feed.MaxUploadSize = 16
+
+	data := testPackage(t, map[string]interface{}{"name": "n", "version": "1.0.0"})
+	rec := httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(data)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	rec = httptest.NewRecorder()
+	target := "/upload?id=5e8f7a52-35ab-4b6c-9a3e-2f0f1b7c9d01&index=0&offset=0&totalSize=1099511627776&totalParts=1"
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, bytes.NewReader([]byte("x"))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("multipart upload: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	entries, err := os.ReadDir(feed.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".part" {
+			t.Errorf("multipart upload file %s was created", entry.Name())
+		}
+	}
+}
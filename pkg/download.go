@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"hash"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 下载失败时的重试策略
+type RetryPolicy struct {
+	// 最多重试的次数,为0时不重试
+	MaxRetries int
+	// 第一次重试前的等待时间,之后每次翻倍
+	InitialBackoff time.Duration
+	// 最长等待时间
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// 第attempt次重试前的等待时间,在[d/2, d]之间随机以避免多个客户端同时重试
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// 网络错误、5xx与429响应可以重试,其它错误直接返回
+func isTransientError(err error) bool {
+	if err == nil || stderrors.Is(err, context.Canceled) {
+		return false
+	}
+	var feedErr *FeedError
+	if stderrors.As(err, &feedErr) {
+		return feedErr.StatusCode >= 500 || feedErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if stderrors.As(err, &netErr) {
+		return true
+	}
+	return stderrors.Is(err, io.ErrUnexpectedEOF) || stderrors.Is(err, io.EOF) || stderrors.Is(err, errIncompleteDownload)
+}
+
+var errIncompleteDownload = stderrors.New("incomplete download")
+
+// 从offset处开始下载模块包,返回本次响应的起始位置与模块包的总长度(未知时为-1)
+// 服务端不支持Range请求时从头开始下载
+func (c *FeedClient) DownloadFrom(ctx context.Context, group, name, version string, offset int64) (io.ReadCloser, int64, int64, error) {
+	req, err := c.newRequest(ctx, "GET", c.endpoint("download/"+packagePath(group, name)+"/"+url.PathEscape(version), nil), nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := c.do(req, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, 0, resp.ContentLength, nil
+	}
+
+	start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || start != offset {
+		_ = resp.Body.Close()
+		return nil, 0, 0, errors.Errorf("invalid Content-Range '%s'", resp.Header.Get("Content-Range"))
+	}
+	return resp.Body, start, total, nil
+}
+
+// 解析"bytes 100-199/200"格式的Content-Range,总长度未知时为-1
+func parseContentRange(value string) (int64, int64, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	rangeAndTotal := strings.SplitN(strings.TrimPrefix(value, "bytes "), "/", 2)
+	if len(rangeAndTotal) != 2 {
+		return 0, 0, false
+	}
+	startAndEnd := strings.SplitN(rangeAndTotal[0], "-", 2)
+	start, err := strconv.ParseInt(startAndEnd[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total := int64(-1)
+	if rangeAndTotal[1] != "*" {
+		total, err = strconv.ParseInt(rangeAndTotal[1], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
+
+// 下载模块包到f中,f中已有的内容视为上次未完成的下载,将通过Range请求继续下载
+// 遇到网络错误或5xx响应时按照重试策略重试,下载完成后校验长度与哈希值
+func (c *FeedClient) DownloadToFile(ctx context.Context, f *os.File, group, name, version string) error {
+	// 获取期望的长度与哈希值,feed不提供时跳过校验
+	expected, err := c.GetVersion(ctx, group, name, version)
+	if err != nil {
+		if IsNotFound(err) || IsUnauthorized(err) {
+			return err
+		}
+		expected = nil
+	}
+
+	progress := NewProgressTracker(c.Progress, ProgressDownload, groupAndName(group, name)+"@"+version, -1)
+	err = c.withRetry(ctx, "download", progress, func() error {
+		err := c.downloadRemaining(ctx, f, group, name, version, progress)
+		if err != nil {
+			return err
+		}
+		err = verifyDownload(f, expected)
+		if err == nil {
+			return nil
+		}
+		// 校验失败时丢弃已下载的内容重新下载
+		if truncateErr := f.Truncate(0); truncateErr != nil {
+			return truncateErr
+		}
+		return errors.Wrap(errIncompleteDownload, err.Error())
+	})
+	if err != nil {
+		return err
+	}
+	progress.Done()
+	return nil
+}
+
+func (c *FeedClient) downloadRemaining(ctx context.Context, f *os.File, group, name, version string, progress *ProgressTracker) error {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	body, start, total, err := c.DownloadFrom(ctx, group, name, version, offset)
+	var feedErr *FeedError
+	if stderrors.As(err, &feedErr) && feedErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// 缓存的部分文件与服务端不一致,从头开始下载
+		offset = 0
+		if err = f.Truncate(0); err == nil {
+			body, start, total, err = c.DownloadFrom(ctx, group, name, version, 0)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if start != offset {
+		if err = f.Truncate(start); err != nil {
+			return err
+		}
+	}
+	if _, err = f.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	progress.SetCurrent(start, total)
+	written, err := io.Copy(io.MultiWriter(f, progress), body)
+	if err != nil {
+		return err
+	}
+	if total >= 0 && start+written != total {
+		return errors.Wrapf(errIncompleteDownload, "received %d of %d bytes", start+written, total)
+	}
+	return nil
+}
+
+// 校验下载的文件与feed提供的长度、哈希值是否一致
+func verifyDownload(f *os.File, expected *RemotePackageVersion) error {
+	if expected == nil {
+		return nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if expected.Size > 0 && fi.Size() != expected.Size {
+		return errors.Errorf("size mismatch: expected %d bytes, got %d", expected.Size, fi.Size())
+	}
+
+	var h hash.Hash
+	var expectedHash string
+	switch {
+	case expected.SHA256 != "":
+		h, expectedHash = sha256.New(), expected.SHA256
+	case expected.SHA1 != "":
+		h, expectedHash = sha1.New(), expected.SHA1
+	default:
+		return nil
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expectedHash) {
+		return errors.Errorf("hash mismatch: expected %s, got %s", strings.ToLower(expectedHash), actual)
+	}
+	return nil
+}
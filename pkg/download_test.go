@@ -0,0 +1,474 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 模拟feed的下载接口,每次下载请求由serveDownload决定如何响应
+type testDownloadServer struct {
+	content []byte
+	sha1    string
+
+	mu sync.Mutex
+	// 每次下载请求的Range请求头,没有时为空字符串
+	ranges []string
+	times  []time.Time
+	// 参数为第几次下载请求(从0开始),返回false时使用默认处理:支持Range请求
+	serveDownload func(w http.ResponseWriter, r *http.Request, attempt int) bool
+}
+
+func newTestDownloadServer(t *testing.T, content []byte) (*testDownloadServer, *FeedClient) {
+	t.Helper()
+	sum := sha1.Sum(content)
+	s := &testDownloadServer{content: content, sha1: hex.EncodeToString(sum[:])}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client := NewFeedClient(srv.URL+"/upack/feed/", nil)
+	client.Retry = &RetryPolicy{MaxRetries: 3, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	client.Progress = QuietProgress{}
+	return s, client
+}
+
+func (s *testDownloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/versions"):
+		_ = json.NewEncoder(w).Encode(RemotePackageVersion{Group: "g", Name: "n", Version: "1.0.0", Size: int64(len(s.content)), SHA1: s.sha1})
+	case strings.Contains(r.URL.Path, "/download/"):
+		s.mu.Lock()
+		attempt := len(s.ranges)
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.times = append(s.times, time.Now())
+		s.mu.Unlock()
+		if s.serveDownload != nil && s.serveDownload(w, r, attempt) {
+			return
+		}
+		s.serveRange(w, r, s.content)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *testDownloadServer) serveRange(w http.ResponseWriter, r *http.Request, content []byte) {
+	value := r.Header.Get("Range")
+	if value == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+		return
+	}
+	start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(value, "bytes="), "-"))
+	if err != nil || start >= len(content) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)-start))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(content[start:])
+}
+
+// 写入部分内容后断开连接
+func abortAfter(w http.ResponseWriter, content []byte, n int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	_, _ = w.Write(content[:n])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (s *testDownloadServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	return content
+}
+
+func tempFileWith(t *testing.T, content []byte) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "n.upack.partial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	if _, err = f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func assertFileContent(t *testing.T, f *os.File, want []byte) {
+	t.Helper()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes, want %d bytes with the same content", len(got), len(want))
+	}
+}
+
+func TestDownloadToFileResumesWithRange(t *testing.T) {
+	content := testContent(64 << 10)
+	s, client := newTestDownloadServer(t, content)
+	f := tempFileWith(t, content[:1000])
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+	if got := s.requests(); len(got) != 1 || got[0] != "bytes=1000-" {
+		t.Fatalf("download requests = %q, want a single request with Range bytes=1000-", got)
+	}
+}
+
+func TestDownloadToFileResumesAfterInterruption(t *testing.T) {
+	content := testContent(64 << 10)
+	s, client := newTestDownloadServer(t, content)
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		if attempt == 0 {
+			abortAfter(w, content, 20000)
+		}
+		return false
+	}
+	f := tempFileWith(t, nil)
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+	got := s.requests()
+	if len(got) != 2 || got[0] != "" || !strings.HasPrefix(got[1], "bytes=") || got[1] == "bytes=0-" {
+		t.Fatalf("download requests = %q, want a full request followed by a Range request", got)
+	}
+}
+
+func TestDownloadToFileServerIgnoresRange(t *testing.T) {
+	content := testContent(64 << 10)
+	s, client := newTestDownloadServer(t, content)
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+		return true
+	}
+	// 已下载的部分与服务端的内容不同,服务端返回200时必须丢弃
+	f := tempFileWith(t, bytes.Repeat([]byte{0xff}, 1000))
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+	if got := s.requests(); len(got) != 1 || got[0] != "bytes=1000-" {
+		t.Fatalf("download requests = %q, want a single request with Range bytes=1000-", got)
+	}
+}
+
+func TestDownloadToFileRetriesServerErrors(t *testing.T) {
+	content := testContent(4 << 10)
+	s, client := newTestDownloadServer(t, content)
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		if attempt < 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	f := tempFileWith(t, nil)
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+
+	s.mu.Lock()
+	times := append([]time.Time(nil), s.times...)
+	s.mu.Unlock()
+	if len(times) != 3 {
+		t.Fatalf("got %d download requests, want 3", len(times))
+	}
+	// 第一次重试等待[10ms, 20ms],第二次等待[20ms, 40ms]
+	if d := times[1].Sub(times[0]); d < 10*time.Millisecond {
+		t.Errorf("first retry after %s, want at least 10ms", d)
+	}
+	if d := times[2].Sub(times[1]); d < 20*time.Millisecond {
+		t.Errorf("second retry after %s, want at least 20ms", d)
+	}
+}
+
+func TestDownloadToFileGivesUpAfterMaxRetries(t *testing.T) {
+	s, client := newTestDownloadServer(t, testContent(1024))
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return true
+	}
+	f := tempFileWith(t, nil)
+
+	err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("expected 502 error, got %v", err)
+	}
+	if got := len(s.requests()); got != client.Retry.MaxRetries+1 {
+		t.Fatalf("got %d download requests, want %d", got, client.Retry.MaxRetries+1)
+	}
+}
+
+func TestDownloadToFileDoesNotRetryClientErrors(t *testing.T) {
+	s, client := newTestDownloadServer(t, testContent(1024))
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return true
+	}
+	f := tempFileWith(t, nil)
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := len(s.requests()); got != 1 {
+		t.Fatalf("got %d download requests, want 1", got)
+	}
+}
+
+func TestDownloadToFileRestartsOnRangeNotSatisfiable(t *testing.T) {
+	content := testContent(4 << 10)
+	s, client := newTestDownloadServer(t, content)
+	// 部分文件比服务端的模块包还长,Range请求返回416
+	f := tempFileWith(t, testContent(8<<10))
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+	if got := s.requests(); len(got) != 2 || got[0] != "bytes=8192-" || got[1] != "" {
+		t.Fatalf("download requests = %q, want a Range request followed by a full request", got)
+	}
+}
+
+func TestDownloadToFileHashMismatch(t *testing.T) {
+	content := testContent(4 << 10)
+	s, client := newTestDownloadServer(t, content)
+	corrupted := append([]byte(nil), content...)
+	corrupted[100] ^= 0xff
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		s.serveRange(w, r, corrupted)
+		return true
+	}
+	f := tempFileWith(t, nil)
+
+	err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+	// 校验失败时丢弃已下载的内容,每次重试都从头下载
+	for _, value := range s.requests() {
+		if value != "" {
+			t.Fatalf("download requests = %q, want only full requests", s.requests())
+		}
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 0 {
+		t.Fatalf("corrupted download was kept: %v", err)
+	}
+}
+
+func TestDownloadToFileRecoversFromHashMismatch(t *testing.T) {
+	content := testContent(4 << 10)
+	s, client := newTestDownloadServer(t, content)
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		if attempt == 0 {
+			corrupted := append([]byte(nil), content...)
+			corrupted[0] ^= 0xff
+			s.serveRange(w, r, corrupted)
+			return true
+		}
+		return false
+	}
+	f := tempFileWith(t, nil)
+
+	if err := client.DownloadToFile(context.Background(), f, "g", "n", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for _, test := range []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{4, 2500 * time.Millisecond, 5 * time.Second},
+		{10, 2500 * time.Millisecond, 5 * time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			if d := policy.backoff(test.attempt); d < test.min || d > test.max {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", test.attempt, d, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestGetOrDownloadFromFeedKeepsPartialWithoutCache(t *testing.T) {
+	content := testContent(64 << 10)
+	s, client := newTestDownloadServer(t, content)
+	client.Retry = &RetryPolicy{}
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		if attempt == 0 {
+			abortAfter(w, content, 30000)
+		}
+		return false
+	}
+	registry := Registry(t.TempDir())
+	version, err := ParseUniversalPackageVersion("1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partialPath := registry.getCachedPackagePath("g", "n", version) + ".partial"
+
+	if _, _, err = registry.GetOrDownloadFromFeed(client, "g", "n", version, false); err == nil {
+		t.Fatal("expected the interrupted download to fail")
+	}
+	fi, err := os.Stat(partialPath)
+	if err != nil || fi.Size() <= 0 {
+		t.Fatalf("partial download was not kept: %v", err)
+	}
+
+	f, done, err := registry.GetOrDownloadFromFeed(client, "g", "n", version, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+	if got := s.requests(); len(got) != 2 || got[1] != fmt.Sprintf("bytes=%d-", fi.Size()) {
+		t.Fatalf("download requests = %q, want the second request to resume at %d", got, fi.Size())
+	}
+	if err = done(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(partialPath); !os.IsNotExist(err) {
+		t.Fatalf("partial file was not removed: %v", err)
+	}
+	if _, err = os.Stat(registry.getCachedPackagePath("g", "n", version)); !os.IsNotExist(err) {
+		t.Fatalf("package was cached although cache is false: %v", err)
+	}
+}
+
+func TestGetOrDownloadFromFeedConcurrentDownloads(t *testing.T) {
+	content := testContent(64 << 10)
+	s, client := newTestDownloadServer(t, content)
+	s.serveDownload = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		//慢速下载,保证两个下载同时进行
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		for offset := 0; offset < len(content); offset += 16 << 10 {
+			_, _ = w.Write(content[offset : offset+16<<10])
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		return true
+	}
+	registry := Registry(t.TempDir())
+	version, err := ParseUniversalPackageVersion("1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, done, err := registry.GetOrDownloadFromFeed(client, "g", "n", version, false)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if _, err = f.Seek(0, io.SeekStart); err == nil {
+				var got []byte
+				if got, err = io.ReadAll(f); err == nil && !bytes.Equal(got, content) {
+					err = fmt.Errorf("downloaded %d bytes, want %d bytes with the same content", len(got), len(content))
+				}
+			}
+			if e := done(); err == nil {
+				err = e
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(registry.getCachedPackagePath("g", "n", version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s was left in the package cache", entry.Name())
+	}
+}
+
+func TestGetOrDownloadFromFeedPartialInUse(t *testing.T) {
+	content := testContent(64 << 10)
+	_, client := newTestDownloadServer(t, content)
+	registry := Registry(t.TempDir())
+	version, err := ParseUniversalPackageVersion("1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachePath := registry.getCachedPackagePath("g", "n", version)
+	if err = os.MkdirAll(filepath.Dir(cachePath), 0777); err != nil {
+		t.Fatal(err)
+	}
+	//其它安装正在写入.partial文件
+	partial, err := openPartialFile(cachePath + ".partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer partial.Close()
+	if _, err = partial.Write([]byte("in progress")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, done, err := registry.GetOrDownloadFromFeed(client, "g", "n", version, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, f, content)
+	if err = done(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(cachePath + ".partial"); err != nil || fi.Size() != int64(len("in progress")) {
+		t.Fatalf("partial file of the other download was modified: %v", err)
+	}
+	matches, _ := filepath.Glob(cachePath + ".*.tmp")
+	if len(matches) > 0 {
+		t.Fatalf("temporary downloads were left behind: %v", matches)
+	}
+}
@@ -0,0 +1,345 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 模块仓储返回的错误类型,可以通过errors.Is判断
+var (
+	ErrNotFound     = stderrors.New("not found")
+	ErrUnauthorized = stderrors.New("unauthorized")
+	ErrConflict     = stderrors.New("conflict")
+)
+
+// 模块仓储返回的HTTP错误
+type FeedError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (err *FeedError) Error() string {
+	return "ProGet returned HTTP error: " + err.Status
+}
+
+func (err *FeedError) Unwrap() error {
+	switch err.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusConflict:
+		return ErrConflict
+	}
+	return nil
+}
+
+func IsNotFound(err error) bool     { return stderrors.Is(err, ErrNotFound) }
+func IsUnauthorized(err error) bool { return stderrors.Is(err, ErrUnauthorized) }
+func IsConflict(err error) bool     { return stderrors.Is(err, ErrConflict) }
+
+// 模块仓储中某个版本的信息
+type RemotePackageVersion struct {
+	Group        string   `json:"group,omitempty"`
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Title        string   `json:"title,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Icon         string   `json:"icon,omitempty"`
+	Published    string   `json:"published,omitempty"`
+	Size         int64    `json:"size,omitempty"`
+	Downloads    int64    `json:"downloads,omitempty"`
+	SHA1         string   `json:"sha1,omitempty"`
+	SHA256       string   `json:"sha256,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+func (v RemotePackageVersion) GroupAndName() string {
+	return groupAndName(v.Group, v.Name)
+}
+
+// 解析发布时间,无法解析时返回false
+func (v RemotePackageVersion) PublishedDate() (time.Time, bool) {
+	var date InstalledPackageDate
+	if v.Published == "" || date.UnmarshalText([]byte(v.Published)) != nil {
+		return time.Time{}, false
+	}
+	return date.Date, true
+}
+
+// ProGet universal feed api客户端
+type FeedClient struct {
+	// feed的api地址,如http://proget/upack/feed/,也可以是本地目录或file://地址
+	FeedURL string
+	// basic认证的用户名与密码,Authenticator不为空时忽略
+	Authentication *[2]string
+	// 为请求添加认证信息,为空时使用Authentication
+	Authenticator Authenticator
+	// 为空时使用默认超时设置的客户端
+	HTTPClient *http.Client
+	// 下载与上传模块包失败时的重试策略,为空时使用DefaultRetryPolicy
+	Retry *RetryPolicy
+	// 超过该大小的模块包分块上传,为0时不分块
+	UploadChunkThreshold int64
+	// 分块上传时每块的大小,为0时使用DefaultUploadChunkSize
+	UploadChunkSize int64
+	// 接收模块包的下载与上传进度,为空时不输出进度
+	Progress ProgressReporter
+}
+
+func NewFeedClient(feedURL string, authentication *[2]string) *FeedClient {
+	return &FeedClient{
+		FeedURL:        feedURL,
+		Authentication: authentication,
+	}
+}
+
+// 未指定HTTPClient时使用默认的超时设置
+var _defaultHTTPClient = DefaultHTTPOptions().Client()
+
+func (c *FeedClient) httpClient() *http.Client {
+	if root, ok := DirectoryFeedRoot(c.FeedURL); ok {
+		return &http.Client{Transport: newDirectoryFeedTransport(root)}
+	}
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return _defaultHTTPClient
+}
+
+func (c *FeedClient) endpoint(path string, query url.Values) string {
+	addr := strings.TrimRight(c.FeedURL, "/")
+	if root, ok := DirectoryFeedRoot(c.FeedURL); ok {
+		addr = strings.TrimRight(directoryFeedURL(root).String(), "/")
+	}
+	if path != "" {
+		addr += "/" + path
+	}
+	if len(query) > 0 {
+		addr += "?" + query.Encode()
+	}
+	return addr
+}
+
+func packagePath(group, name string) string {
+	encodedName := url.PathEscape(name)
+	if group != "" {
+		encodedName = url.PathEscape(group) + "/" + encodedName
+	}
+	return encodedName
+}
+
+func (c *FeedClient) newRequest(ctx context.Context, method, addr string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, addr, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Authenticator != nil {
+		if err = c.Authenticator.Authenticate(req); err != nil {
+			return nil, err
+		}
+	} else if c.Authentication != nil {
+		req.SetBasicAuth(c.Authentication[0], c.Authentication[1])
+	}
+	return req, nil
+}
+
+// 发送请求,状态码不在expected中时返回FeedError
+func (c *FeedClient) do(req *http.Request, expected ...int) (*http.Response, error) {
+	resp, err := RedirectSafeClient(c.httpClient()).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, statusCode := range expected {
+		if resp.StatusCode == statusCode {
+			return resp, nil
+		}
+	}
+	if len(expected) == 0 && resp.StatusCode < 400 {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return nil, &FeedError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+}
+
+func (c *FeedClient) getJSON(ctx context.Context, addr string, v interface{}) error {
+	req, err := c.newRequest(ctx, "GET", addr, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// 列出feed中的模块,group为空时列出所有模块
+func (c *FeedClient) ListPackages(ctx context.Context, group string) ([]*RemotePackageMetadata, error) {
+	query := url.Values{}
+	if group != "" {
+		query.Set("group", group)
+	}
+	var packages []*RemotePackageMetadata
+	err := c.getJSON(ctx, c.endpoint("packages", query), &packages)
+	if err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// 获取指定模块的信息与版本列表
+func (c *FeedClient) GetPackage(ctx context.Context, group, name string) (*RemotePackageMetadata, error) {
+	var data RemotePackageMetadata
+	err := c.getJSON(ctx, c.endpoint("packages", url.Values{"group": {group}, "name": {name}}), &data)
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// 列出指定模块所有版本的详细信息
+func (c *FeedClient) ListVersions(ctx context.Context, group, name string) ([]*RemotePackageVersion, error) {
+	var versions []*RemotePackageVersion
+	err := c.getJSON(ctx, c.endpoint("versions", url.Values{"group": {group}, "name": {name}}), &versions)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// 获取指定版本的详细信息,版本不存在时返回ErrNotFound
+func (c *FeedClient) GetVersion(ctx context.Context, group, name, version string) (*RemotePackageVersion, error) {
+	var data RemotePackageVersion
+	addr := c.endpoint("versions", url.Values{"group": {group}, "name": {name}, "version": {version}})
+	err := c.getJSON(ctx, addr, &data)
+	if err != nil {
+		return nil, err
+	}
+	if data.SHA1 == "" && data.Version == "" {
+		return nil, &FeedError{Method: "GET", URL: addr, StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	return &data, nil
+}
+
+// 下载模块包,返回的size为-1时表示长度未知
+func (c *FeedClient) Download(ctx context.Context, group, name, version string) (io.ReadCloser, int64, error) {
+	body, _, size, err := c.DownloadFrom(ctx, group, name, version, 0)
+	return body, size, err
+}
+
+// 下载模块包中的单个文件,version为空时读取最新版本
+func (c *FeedClient) DownloadFile(ctx context.Context, group, name, version, filePath string) (io.ReadCloser, error) {
+	addr := c.endpoint("download-file/"+packagePath(group, name), nil)
+	if version == "" {
+		addr += "?latest&path=" + url.QueryEscape(filePath)
+	} else {
+		addr += "/" + url.PathEscape(version) + "?path=" + url.QueryEscape(filePath)
+	}
+	req, err := c.newRequest(ctx, "GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// 读取指定版本的upack.json,version为空时读取最新版本
+func (c *FeedClient) GetManifest(ctx context.Context, group, name, version string) (*UniversalPackageMetadata, error) {
+	r, err := c.DownloadFile(ctx, group, name, version, "upack.json")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ReadManifest(r)
+}
+
+// 上传模块包到feed,r实现了io.ReaderAt时使用UploadFile,失败后可以重试与分块上传
+func (c *FeedClient) Upload(ctx context.Context, r io.Reader, size int64) error {
+	if ra, ok := r.(io.ReaderAt); ok && size >= 0 {
+		return c.UploadFile(ctx, ra, size, "")
+	}
+	return c.uploadBody(ctx, http.MethodPut, c.endpoint("", nil), r, size, nil, http.StatusCreated)
+}
+
+// 从feed中删除指定版本的模块
+func (c *FeedClient) Delete(ctx context.Context, group, name, version string) error {
+	req, err := c.newRequest(ctx, "DELETE", c.endpoint("delete/"+packagePath(group, name)+"/"+url.PathEscape(version), nil), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// 获取指定模块的所有版本
+func (c *FeedClient) GetPackageVersions(ctx context.Context, group, name string) ([]*UniversalPackageVersion, error) {
+	data, err := c.GetPackage(ctx, group, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.Versions) == 0 {
+		return nil, fmt.Errorf("no versions of package %s found", groupAndName(group, name))
+	}
+
+	versions := make([]*UniversalPackageVersion, 0, len(data.Versions))
+	for _, v := range data.Versions {
+		version, err := ParseUniversalPackageVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// 获取指定模块的最新版本,version不为空且不为latest时直接返回version
+func (c *FeedClient) GetLatestVersion(ctx context.Context, group, name, version string, prerelease bool) (string, error) {
+	if version != "" && !strings.EqualFold(version, "latest") && !prerelease {
+		return version, nil
+	}
+
+	versions, err := c.GetPackageVersions(ctx, group, name)
+	if err != nil {
+		return "", err
+	}
+
+	var latestVersion *UniversalPackageVersion
+	for _, version := range versions {
+		if !prerelease && version.Prerelease != "" {
+			continue
+		}
+		if latestVersion == nil || latestVersion.Compare(version) < 0 {
+			latestVersion = version
+		}
+	}
+	if latestVersion == nil {
+		return "", fmt.Errorf("no versions of package %s found", groupAndName(group, name))
+	}
+	return latestVersion.String(), nil
+}
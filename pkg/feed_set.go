@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// 按优先级排列的多个feed,查询版本时合并所有feed的结果,读取与下载时依次尝试
+type FeedSet []*FeedClient
+
+// 是否可以尝试下一个feed:模块不存在或者网络错误
+func canFallback(err error) bool {
+	return IsNotFound(err) || isTransientError(err)
+}
+
+// 合并所有feed中指定模块的版本,部分feed无法访问时忽略
+func (s FeedSet) GetPackageVersions(ctx context.Context, group, name string) ([]*UniversalPackageVersion, error) {
+	var result []*UniversalPackageVersion
+	seen := make(map[string]bool)
+	var firstErr error
+	found := false
+	for _, feed := range s {
+		data, err := feed.GetPackage(ctx, group, name)
+		if err != nil {
+			if !canFallback(err) {
+				return nil, err
+			}
+			if !IsNotFound(err) {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", feed.FeedURL, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		found = true
+		for _, v := range data.Versions {
+			version, err := ParseUniversalPackageVersion(v)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[version.String()] {
+				seen[version.String()] = true
+				result = append(result, version)
+			}
+		}
+	}
+	if !found {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("no versions of package %s found", groupAndName(group, name))
+		}
+		return nil, firstErr
+	}
+	return result, nil
+}
+
+// 从第一个包含该版本的feed中读取upack.json
+func (s FeedSet) GetManifest(ctx context.Context, group, name, version string) (*UniversalPackageMetadata, error) {
+	var firstErr error
+	for _, feed := range s {
+		metadata, err := feed.GetManifest(ctx, group, name, version)
+		if err == nil {
+			return metadata, nil
+		}
+		if !canFallback(err) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no feeds configured")
+	}
+	return nil, firstErr
+}
+
+// 依次从各个feed下载模块包,模块不存在或网络错误时尝试下一个feed,返回实际提供模块包的feed
+func (r Registry) GetOrDownloadFromFeeds(feeds FeedSet, group, name string, version *UniversalPackageVersion, cache bool) (*os.File, func() error, *FeedClient, error) {
+	var firstErr error
+	for index, feed := range feeds {
+		f, done, err := r.GetOrDownloadFromFeed(feed, group, name, version, cache)
+		if err == nil {
+			return f, done, feed, nil
+		}
+		if !canFallback(err) {
+			return nil, nil, nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if index+1 < len(feeds) {
+			ReportMessage(feed.Progress, ProgressDownload, fmt.Sprintf("%s/%s@%s", group, name, version.String()), fmt.Sprintf("%s: %v, trying %s", feed.FeedURL, err, feeds[index+1].FeedURL))
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no feeds configured")
+	}
+	return nil, nil, nil, firstErr
+}
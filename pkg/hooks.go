@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// upack.json中hooks支持的生命周期名称
+const (
+	HookPreInstall   = "preInstall"
+	HookPostInstall  = "postInstall"
+	HookPreUninstall = "preUninstall"
+	HookPostUpgrade  = "postUpgrade"
+)
+
+// 钩子脚本未指定timeout时的默认超时时间
+const DefaultHookTimeout = 5 * time.Minute
+
+var _hookNames = []string{HookPreInstall, HookPostInstall, HookPreUninstall, HookPostUpgrade}
+
+// 声明在upack.json中的生命周期钩子,脚本路径相对于包中的package/目录
+type PackageHook struct {
+	Name    string
+	Script  string
+	Timeout time.Duration
+}
+
+// 执行钩子时传递给脚本的环境信息
+type HookEnvironment struct {
+	Group           string
+	Name            string
+	Version         string
+	PreviousVersion string
+	TargetDirectory string
+	//接收执行信息与脚本输出,为nil时输出到标准输出
+	Progress ProgressReporter
+}
+
+// 读取upack.json中声明的hooks,支持以下两种写法:
+//
+//	"hooks": {"postInstall": "scripts/migrate.sh"}
+//	"hooks": {"postInstall": {"script": "scripts/migrate.sh", "timeout": 120}}
+//
+// timeout可以是秒数或者"2m"这样的时长字符串
+func (meta UniversalPackageMetadata) Hooks() (map[string]*PackageHook, error) {
+	value, ok := meta["hooks"]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	hooks, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("hooks must be an object.")
+	}
+
+	result := make(map[string]*PackageHook, len(hooks))
+	for key, value := range hooks {
+		name := normalizeHookName(key)
+		if name == "" {
+			return nil, errors.Errorf("hooks contains unknown hook: '%s'", key)
+		}
+		hook := &PackageHook{Name: name, Timeout: DefaultHookTimeout}
+		switch v := value.(type) {
+		case string:
+			hook.Script = v
+		case map[string]interface{}:
+			hook.Script, _ = v["script"].(string)
+			if timeout, ok := v["timeout"]; ok {
+				d, err := parseHookTimeout(timeout)
+				if err != nil {
+					return nil, errors.Wrapf(err, "hooks.%s.timeout", name)
+				}
+				hook.Timeout = d
+			}
+		default:
+			return nil, errors.Errorf("hooks.%s must be a script path or an object.", name)
+		}
+		if strings.TrimSpace(hook.Script) == "" {
+			return nil, errors.Errorf("hooks.%s is missing script.", name)
+		}
+		if !isRelativeSubPath(hook.Script) {
+			return nil, errors.Errorf("hooks.%s script must be a relative path inside package/.", name)
+		}
+		result[name] = hook
+	}
+	return result, nil
+}
+
+// 获取指定名称的钩子,未声明时返回nil
+func (meta UniversalPackageMetadata) Hook(name string) (*PackageHook, error) {
+	hooks, err := meta.Hooks()
+	if err != nil {
+		return nil, err
+	}
+	return hooks[name], nil
+}
+
+func normalizeHookName(name string) string {
+	for _, each := range _hookNames {
+		if strings.EqualFold(each, name) {
+			return each
+		}
+	}
+	return ""
+}
+
+func parseHookTimeout(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case float64:
+		if v <= 0 {
+			return 0, errors.New("must be greater than 0")
+		}
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, err
+		}
+		if d <= 0 {
+			return 0, errors.New("must be greater than 0")
+		}
+		return d, nil
+	}
+	return 0, errors.New("must be a number of seconds or a duration string")
+}
+
+func isRelativeSubPath(p string) bool {
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return false
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(p))
+	return cleaned != ".." && !strings.HasPrefix(cleaned, ".."+string(filepath.Separator))
+}
+
+// 执行upack.json中声明的钩子,未声明该钩子时直接返回
+// 脚本的标准输出与错误输出会被收集并通过env.Progress输出,执行失败时一并包含在错误信息中
+func RunHook(meta *UniversalPackageMetadata, name string, env HookEnvironment) error {
+	if meta == nil {
+		return nil
+	}
+	hook, err := meta.Hook(name)
+	if err != nil || hook == nil {
+		return err
+	}
+	return hook.Run(env)
+}
+
+// 在解压模块包之前执行钩子(preInstall):只从zipFile的package/目录中读取脚本本身到临时目录执行,
+// 安装目录已存在(如重新安装或升级)时在安装目录中执行,否则在临时目录中执行
+func RunHookFromZip(meta *UniversalPackageMetadata, name string, zipFile *zip.Reader, env HookEnvironment) error {
+	if meta == nil {
+		return nil
+	}
+	hook, err := meta.Hook(name)
+	if err != nil || hook == nil {
+		return err
+	}
+
+	tempDirectory, err := os.MkdirTemp("", "upack-hook")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDirectory)
+	scriptPath, err := extractHookScript(zipFile, hook, tempDirectory)
+	if err != nil {
+		return err
+	}
+
+	workDirectory := tempDirectory
+	if fi, err := os.Stat(env.TargetDirectory); err == nil && fi.IsDir() {
+		workDirectory = env.TargetDirectory
+	}
+	return hook.run(scriptPath, workDirectory, env)
+}
+
+// 将钩子脚本从模块包中解压到directory中,返回脚本路径
+func extractHookScript(zipFile *zip.Reader, hook *PackageHook, directory string) (string, error) {
+	script := path.Clean(filepath.ToSlash(hook.Script))
+	for _, entry := range zipFile.File {
+		if len(entry.Name) <= len("package/") || !strings.EqualFold(entry.Name[:len("package/")], "package/") ||
+			entry.Name[len("package/"):] != script || entry.Mode().IsDir() {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		scriptPath := filepath.Join(directory, path.Base(script))
+		f, err := os.OpenFile(scriptPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entry.Mode().Perm()|0600)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(f, r)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		return scriptPath, err
+	}
+	return "", errors.Errorf("%s hook script '%s' not found", hook.Name, hook.Script)
+}
+
+func (h *PackageHook) Run(env HookEnvironment) error {
+	workDirectory := env.TargetDirectory
+	if workDirectory == "" {
+		workDirectory, _ = os.Getwd()
+	}
+	return h.run(filepath.Join(workDirectory, filepath.FromSlash(h.Script)), workDirectory, env)
+}
+
+// 在workDirectory中执行scriptPath
+func (h *PackageHook) run(scriptPath, workDirectory string, env HookEnvironment) error {
+	if _, err := os.Stat(scriptPath); err != nil {
+		return errors.Wrapf(err, "%s hook script '%s' not found", h.Name, h.Script)
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	targetDirectory := env.TargetDirectory
+	if targetDirectory == "" {
+		targetDirectory = workDirectory
+	}
+	cmd := hookCommand(scriptPath)
+	cmd.Dir = workDirectory
+	cmd.Env = append(os.Environ(),
+		"UPACK_HOOK="+h.Name,
+		"UPACK_GROUP="+env.Group,
+		"UPACK_NAME="+env.Name,
+		"UPACK_VERSION="+env.Version,
+		"UPACK_PREVIOUS_VERSION="+env.PreviousVersion,
+		"UPACK_TARGET_DIRECTORY="+targetDirectory,
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	ReportMessage(env.Progress, ProgressHook, h.Name, "running "+h.Name+" hook "+h.Script)
+	startTime := time.Now()
+	err := runHookCommand(ctx, cmd)
+	printHookOutput(env.Progress, h.Name, output.Bytes())
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("%s hook '%s' timed out after %s", h.Name, h.Script, timeout)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s hook '%s' failed", h.Name, h.Script)
+	}
+	ReportMessage(env.Progress, ProgressHook, h.Name, fmt.Sprintf("%s hook finished elapsed time:%.0f seconds", h.Name, time.Since(startTime).Seconds()))
+	return nil
+}
+
+// 超时后结束脚本及其启动的所有子进程;只结束脚本本身时,
+// 仍在运行的子进程持有输出管道,Wait会一直等到子进程退出
+func runHookCommand(ctx context.Context, cmd *exec.Cmd) error {
+	setHookProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killHookProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	return err
+}
+
+func hookCommand(scriptPath string) *exec.Cmd {
+	switch strings.ToLower(filepath.Ext(scriptPath)) {
+	case ".sh":
+		return exec.Command("sh", scriptPath)
+	case ".ps1":
+		return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", scriptPath)
+	case ".bat", ".cmd":
+		return exec.Command("cmd", "/c", scriptPath)
+	}
+	if runtime.GOOS != "windows" {
+		// 解压后的脚本可能没有执行权限
+		if fi, err := os.Stat(scriptPath); err == nil && fi.Mode()&0111 == 0 {
+			return exec.Command("sh", scriptPath)
+		}
+	}
+	return exec.Command(scriptPath)
+}
+
+func printHookOutput(progress ProgressReporter, name string, output []byte) {
+	text := strings.TrimRight(string(output), "\r\n")
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		ReportMessage(progress, ProgressHook, name, fmt.Sprintf("[%s] %s", name, strings.TrimRight(line, "\r")))
+	}
+}
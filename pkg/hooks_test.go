@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackageHookTimeoutKillsChildProcesses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hook.sh"), []byte("echo started\nsleep 8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := &PackageHook{Name: HookPostInstall, Script: "hook.sh", Timeout: time.Second}
+
+	start := time.Now()
+	err := hook.Run(HookEnvironment{TargetDirectory: dir})
+	elapsed := time.Since(start)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed > 4*time.Second {
+		t.Fatalf("hook returned after %s, the timeout was not enforced", elapsed)
+	}
+}
+
+func testHookPackage(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRunHookFromZipBeforeExtracting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	meta := &UniversalPackageMetadata{"hooks": map[string]interface{}{HookPreInstall: "scripts/pre.sh"}}
+	zipFile := testHookPackage(t, map[string]string{
+		"upack.json":             "{}",
+		"package/new.txt":        "new",
+		"package/scripts/pre.sh": `echo "$(pwd) $UPACK_TARGET_DIRECTORY $(ls)" > "$HOOK_OUTPUT"` + "\n",
+	})
+	output := filepath.Join(t.TempDir(), "output")
+	t.Setenv("HOOK_OUTPUT", output)
+
+	//升级时在已有的安装目录中执行,新版本的文件还没有解压
+	target, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(target, "old.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = RunHookFromZip(meta, HookPreInstall, zipFile, HookEnvironment{TargetDirectory: target}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); len(got) != 3 || got[0] != target || got[1] != target || got[2] != "old.txt" {
+		t.Fatalf("hook output = %q", data)
+	}
+
+	//首次安装时安装目录不存在,在临时目录中执行且不创建安装目录
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err = RunHookFromZip(meta, HookPreInstall, zipFile, HookEnvironment{TargetDirectory: missing}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(output); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); len(got) != 3 || got[1] != missing || got[2] != "pre.sh" {
+		t.Fatalf("hook output = %q", data)
+	}
+	if _, err = os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("target directory was created before extracting: %v", err)
+	}
+}
+
+func TestRunHookFromZipMissingScript(t *testing.T) {
+	meta := &UniversalPackageMetadata{"hooks": map[string]interface{}{HookPreInstall: "scripts/pre.sh"}}
+	zipFile := testHookPackage(t, map[string]string{"upack.json": "{}", "package/scripts/other.sh": ""})
+	err := RunHookFromZip(meta, HookPreInstall, zipFile, HookEnvironment{TargetDirectory: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing script error, got %v", err)
+	}
+}
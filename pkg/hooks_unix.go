@@ -0,0 +1,22 @@
+//go:build !windows
+
+package pkg
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// 钩子脚本在单独的进程组中运行,超时后可以结束整个进程组
+func setHookProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killHookProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
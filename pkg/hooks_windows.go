@@ -0,0 +1,20 @@
+//go:build windows
+
+package pkg
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func setHookProcessGroup(cmd *exec.Cmd) {}
+
+// 通过taskkill /T结束脚本及其启动的所有子进程
+func killHookProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
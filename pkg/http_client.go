@@ -0,0 +1,205 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 访问模块仓储时使用的http设置
+type HTTPOptions struct {
+	// 建立连接(包括TLS握手)的超时时间,为0时不限制
+	ConnectTimeout time.Duration
+	// 发送完请求后等待响应、读取响应时两次收到数据之间以及两次写入数据之间的最长时间,为0时不限制;
+	// 只在等待数据时计时,不会限制大文件上传与下载的总时长
+	ReadTimeout time.Duration
+	// 代理地址,为空时使用HTTP_PROXY/HTTPS_PROXY环境变量
+	Proxy string
+	// 额外信任的CA证书文件(PEM格式)
+	CAFile string
+	// 客户端证书与私钥文件(PEM格式)
+	ClientCertFile string
+	ClientKeyFile  string
+	// 不校验服务端证书,仅用于测试环境
+	Insecure bool
+}
+
+// 默认的超时时间
+const (
+	DefaultConnectTimeout = 30 * time.Second
+	DefaultReadTimeout    = 2 * time.Minute
+)
+
+func DefaultHTTPOptions() HTTPOptions {
+	return HTTPOptions{
+		ConnectTimeout: DefaultConnectTimeout,
+		ReadTimeout:    DefaultReadTimeout,
+	}
+}
+
+// 根据设置创建http客户端
+func NewHTTPClient(options HTTPOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy '%s'", options.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := options.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport.TLSHandshakeTimeout = options.ConnectTimeout
+	transport.ResponseHeaderTimeout = options.ReadTimeout
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || options.ReadTimeout <= 0 {
+			return conn, err
+		}
+		return &writeTimeoutConn{Conn: conn, timeout: options.ReadTimeout}, nil
+	}
+
+	if options.ReadTimeout <= 0 {
+		return &http.Client{Transport: transport}, nil
+	}
+	return &http.Client{Transport: &idleTimeoutTransport{RoundTripper: transport, timeout: options.ReadTimeout}}, nil
+}
+
+func (options HTTPOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+
+	if options.CAFile != "" {
+		data, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading CA file '%s'", options.CAFile)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in CA file '%s'", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.ClientCertFile != "" || options.ClientKeyFile != "" {
+		if options.ClientCertFile == "" || options.ClientKeyFile == "" {
+			return nil, errors.New("both client certificate and client key must be specified")
+		}
+		cert, err := tls.LoadX509KeyPair(options.ClientCertFile, options.ClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// 每次写入前重新设置超时时间,长时间无法写入时失败.
+// 不能同样设置读取的超时时间,发送请求内容时transport一直在等待读取响应,上传时间超过超时时间就会失败
+type writeTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *writeTimeoutConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// 响应头的超时由ResponseHeaderTimeout控制,读取响应内容时超过timeout没有收到数据则取消请求
+type idleTimeoutTransport struct {
+	http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := &idleTimeoutBody{ReadCloser: resp.Body, timeout: t.timeout, cancel: cancel}
+	body.timer = time.AfterFunc(t.timeout, body.expire)
+	body.timer.Stop()
+	resp.Body = body
+	return resp, nil
+}
+
+// 只在等待数据时计时,调用方处理数据的时间不计算在内
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func (b *idleTimeoutBody) expire() {
+	b.mu.Lock()
+	b.expired = true
+	b.mu.Unlock()
+	b.cancel()
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		expired := b.expired
+		b.mu.Unlock()
+		if expired {
+			err = errors.Errorf("no data received for %s", b.timeout)
+		}
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// 创建http客户端失败时使用,所有请求都返回创建时的错误
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// 与NewHTTPClient相同,但设置无效时返回的客户端在发送请求时返回错误
+func (options HTTPOptions) Client() *http.Client {
+	client, err := NewHTTPClient(options)
+	if err != nil {
+		return &http.Client{Transport: errorTransport{err: errors.Wrap(err, "invalid http configuration")}}
+	}
+	return client
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 每次读取前等待delay,模拟慢速但一直有数据的连接
+type slowReader struct {
+	chunks int
+	delay  time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.chunks <= 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	r.chunks--
+	return copy(p, "0123456789"), nil
+}
+
+func TestHTTPClientSlowUploadExceedsReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, strings.Repeat("x", int(n)))
+	}))
+	defer server.Close()
+
+	options := DefaultHTTPOptions()
+	options.ReadTimeout = 200 * time.Millisecond
+	client, err := NewHTTPClient(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := client.Post(server.URL, "application/octet-stream", &slowReader{chunks: 8, delay: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("upload failed after %s: %v", time.Since(start), err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || len(data) != 80 {
+		t.Fatalf("status = %d, received %d bytes", resp.StatusCode, len(data))
+	}
+	if elapsed := time.Since(start); elapsed < 4*options.ReadTimeout {
+		t.Fatalf("upload took %s, expected it to outlast the read timeout", elapsed)
+	}
+}
+
+func TestHTTPClientSlowDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 8; i++ {
+			_, _ = io.WriteString(w, "0123456789")
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	options := DefaultHTTPOptions()
+	options.ReadTimeout = 200 * time.Millisecond
+	client := options.Client()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 80 {
+		t.Fatalf("received %d bytes", len(data))
+	}
+}
+
+func TestHTTPClientStalledDownload(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "0123456789")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	options := DefaultHTTPOptions()
+	options.ReadTimeout = 200 * time.Millisecond
+	client := options.Client()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	start := time.Now()
+	_, err = io.ReadAll(resp.Body)
+	if err == nil || !strings.Contains(err.Error(), "no data received") {
+		t.Fatalf("expected idle timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("idle timeout took %s", elapsed)
+	}
+}
@@ -2,11 +2,11 @@ package pkg
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/user"
-	"strings"
 )
 
 type Install struct {
@@ -164,18 +164,12 @@ func (i *Install) Run() int {
 
 func (i *Install) OpenPackage() (io.ReaderAt, int64, func() error, error) {
 	var r Registry
-	var group, name string
 	var version *UniversalPackageVersion
 
-	parts := strings.Split(strings.Replace(i.PackageName, ":", "/", -1), "/")
-	if len(parts) == 1 {
-		name = parts[0]
-	} else {
-		group = strings.Join(parts[:len(parts)-1], "/")
-		name = parts[len(parts)-1]
-	}
+	group, name := SplitGroupAndName(i.PackageName)
+	feed := NewFeedClient(i.SourceURL, i.Authentication)
 
-	versionString, err := GetVersion(i.SourceURL, group, name, i.Version, i.Authentication, i.Prerelease)
+	versionString, err := feed.GetLatestVersion(context.Background(), group, name, i.Version, i.Prerelease)
 	if err != nil {
 		return nil, 0, nil, err
 	}
@@ -203,7 +197,7 @@ func (i *Install) OpenPackage() (io.ReaderAt, int64, func() error, error) {
 		return nil, 0, nil, err
 	}
 
-	f, done, err := r.GetOrDownload(group, name, version, i.SourceURL, i.Authentication, i.CachePackages)
+	f, done, err := r.GetOrDownloadFromFeed(feed, group, name, version, i.CachePackages)
 	if err != nil {
 		return nil, 0, nil, err
 	}
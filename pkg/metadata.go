@@ -1,12 +1,10 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
-	"strings"
 )
 
 type Metadata struct {
@@ -80,41 +78,25 @@ func (m *Metadata) Run() int {
 		filePath = "upack.json"
 	}
 
-	addr := strings.TrimRight(m.SourceURL, "/") + "/download-file/" + url.PathEscape(m.PackageName)
-	if m.Version == "" {
-		addr += "?latest&path=" + url.QueryEscape(filePath)
-	} else {
+	version := ""
+	if m.Version != "" {
 		v, err := ParseUniversalPackageVersion(m.Version)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Invalid UPack version number:", m.Version)
 			return 1
 		}
-		addr += "/" + url.PathEscape(v.String()) + "?path=" + url.QueryEscape(filePath)
+		version = v.String()
 	}
 
-	req, err := http.NewRequest("GET", addr, nil)
+	group, name := SplitGroupAndName(m.PackageName)
+	body, err := NewFeedClient(m.SourceURL, m.Authentication).DownloadFile(context.Background(), group, name, version, filePath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
+	defer body.Close()
 
-	if m.Authentication != nil {
-		req.SetBasicAuth(m.Authentication[0], m.Authentication[1])
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		fmt.Fprintln(os.Stderr, "Server returned error:", resp.Status)
-		return 1
-	}
-
-	dec := json.NewDecoder(resp.Body)
+	dec := json.NewDecoder(body)
 	dec.UseNumber()
 	token, err := dec.Token()
 	if err != nil {
@@ -180,7 +180,13 @@ func (p *Pack) Run() int {
 	}
 
 	targetFileName := filepath.Join(p.TargetDirectory, info.Name()+"-"+info.BareVersion()+".upack")
-	tmpFile, err := os.CreateTemp("", "upack")
+	err = os.MkdirAll(filepath.Dir(targetFileName), 0755)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// Create the temporary file next to the target so that it can be renamed into place.
+	tmpFile, err := os.CreateTemp(filepath.Dir(targetFileName), ".upack")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
@@ -189,8 +195,8 @@ func (p *Pack) Run() int {
 	defer func() {
 		if tmpFile != nil {
 			_ = tmpFile.Close()
-			_ = os.Remove(tmpPath)
 		}
+		_ = os.Remove(tmpPath)
 	}()
 
 	zipFile := zip.NewWriter(tmpFile)
@@ -228,23 +234,18 @@ func (p *Pack) Run() int {
 		return 1
 	}
 
-	err = os.MkdirAll(filepath.Dir(targetFileName), 0755)
+	err = tmpFile.Close()
+	tmpFile = nil
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 	err = os.Remove(targetFileName)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	err = tmpFile.Close()
-	tmpFile = nil
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
-	err = os.Rename(targetFileName, tmpPath)
+	err = os.Rename(tmpPath, targetFileName)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
@@ -1,5 +1,9 @@
 package pkg
 
+import (
+	"fmt"
+)
+
 type UniversalPackageMetadata map[string]interface{}
 
 func (meta UniversalPackageMetadata) getString(key string) string {
@@ -123,3 +127,47 @@ func (meta UniversalPackageMetadata) GroupAndName() string {
 	}
 	return meta.Name()
 }
+
+// upack.json中requires声明的宿主版本约束,如"requires": {"host": ">=3.2 <4"}
+func (meta UniversalPackageMetadata) HostRequirement() string {
+	requires, ok := meta["requires"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	host, _ := requires["host"].(string)
+	return host
+}
+
+// 检查模块是否兼容指定的宿主版本,未声明约束或未提供宿主版本时视为兼容
+func (meta UniversalPackageMetadata) CheckHostVersion(hostVersion string) error {
+	requirement := meta.HostRequirement()
+	if requirement == "" || hostVersion == "" {
+		return nil
+	}
+	constraint, err := ParseVersionConstraint(requirement)
+	if err != nil {
+		return err
+	}
+	host, err := ParsePartialVersion(hostVersion)
+	if err != nil {
+		return fmt.Errorf("invalid host version '%s'", hostVersion)
+	}
+	if !constraint.Check(host) {
+		return HostIncompatible{
+			Package:     meta.GroupAndName() + "@" + meta.Version(),
+			Requirement: requirement,
+			HostVersion: hostVersion,
+		}
+	}
+	return nil
+}
+
+type HostIncompatible struct {
+	Package     string
+	Requirement string
+	HostVersion string
+}
+
+func (err HostIncompatible) Error() string {
+	return fmt.Sprintf("%s requires host version %s, but the host version is %s", err.Package, err.Requirement, err.HostVersion)
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package pkg
+
+import (
+	"os"
+	"syscall"
+)
+
+// 打开下载中的.partial文件并加独占锁,其它安装正在写入该文件时返回errPartialFileBusy;
+// 进程退出时锁自动释放,中断的下载可以继续
+func openPartialFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errPartialFileBusy
+		}
+		return nil, err
+	}
+	// 加锁前其它安装已完成下载并改名时,打开的已不是.partial文件
+	opened, err := f.Stat()
+	if err == nil {
+		var current os.FileInfo
+		current, err = os.Stat(path)
+		if err == nil && !os.SameFile(opened, current) {
+			err = errPartialFileBusy
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		if os.IsNotExist(err) {
+			err = errPartialFileBusy
+		}
+		return nil, err
+	}
+	return f, nil
+}
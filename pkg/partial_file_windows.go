@@ -0,0 +1,28 @@
+//go:build windows
+
+package pkg
+
+import (
+	"os"
+	"syscall"
+)
+
+// 文件被其它句柄以不共享的方式打开
+const errorSharingViolation syscall.Errno = 32
+
+// 以不共享的方式打开下载中的.partial文件,其它安装正在写入该文件时返回errPartialFileBusy;
+// 进程退出时句柄自动关闭,中断的下载可以继续
+func openPartialFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, errPartialFileBusy
+		}
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
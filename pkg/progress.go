@@ -0,0 +1,328 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 进度的阶段
+const (
+	ProgressDownload = "download"
+	ProgressUpload   = "upload"
+	ProgressExtract  = "extract"
+	ProgressHook     = "hook"
+	// 安装与卸载的结果
+	ProgressInstall   = "install"
+	ProgressUninstall = "uninstall"
+)
+
+// 一次进度通知,下载与上传时单位为字节,解压时单位为文件数
+type Progress struct {
+	Stage   string
+	Name    string
+	Current int64
+	// 总量,未知时为-1
+	Total int64
+	// 每秒处理的数量
+	Rate float64
+	// 预计剩余时间,未知时为-1
+	ETA  time.Duration
+	Done bool
+}
+
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Current) * 100 / float64(p.Total)
+}
+
+// 接收下载、上传与解压进度
+type ProgressReporter interface {
+	Report(p Progress)
+}
+
+// 下载、解压等过程中的提示信息,如开始下载、重试以及钩子脚本的输出
+type ProgressMessage struct {
+	Stage string
+	Name  string
+	Text  string
+}
+
+// 同时接收提示信息的ProgressReporter
+type MessageReporter interface {
+	Message(m ProgressMessage)
+}
+
+// 通过reporter输出提示信息:reporter为nil时输出到标准输出,
+// 未实现MessageReporter时输出到标准错误,避免混入reporter的输出
+func ReportMessage(reporter ProgressReporter, stage, name, text string) {
+	switch r := reporter.(type) {
+	case nil:
+		fmt.Println(text)
+	case MessageReporter:
+		r.Message(ProgressMessage{Stage: stage, Name: name, Text: text})
+	default:
+		fmt.Fprintln(os.Stderr, text)
+	}
+}
+
+// 不输出任何进度
+type QuietProgress struct{}
+
+func (QuietProgress) Report(Progress) {}
+
+func (QuietProgress) Message(ProgressMessage) {}
+
+// 每行输出一个json对象的进度,供其它程序读取
+type JSONProgress struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func NewJSONProgress(w io.Writer) *JSONProgress {
+	return &JSONProgress{w: w}
+}
+
+func (j *JSONProgress) Report(p Progress) {
+	event := struct {
+		Stage   string  `json:"stage"`
+		Name    string  `json:"name"`
+		Current int64   `json:"current"`
+		Total   int64   `json:"total"`
+		Rate    float64 `json:"rate"`
+		ETA     float64 `json:"eta"`
+		Done    bool    `json:"done"`
+	}{p.Stage, p.Name, p.Current, p.Total, p.Rate, p.ETA.Seconds(), p.Done}
+	if p.ETA < 0 {
+		event.ETA = -1
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = json.NewEncoder(j.w).Encode(&event)
+}
+
+func (j *JSONProgress) Message(m ProgressMessage) {
+	event := struct {
+		Stage   string `json:"stage"`
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	}{m.Stage, m.Name, m.Text}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = json.NewEncoder(j.w).Encode(&event)
+}
+
+// 终端进度条,输出不是终端时每完成10%输出一行
+type TerminalProgress struct {
+	w           io.Writer
+	interactive bool
+	mu          sync.Mutex
+	lastStep    map[string]int64
+	// 进度条所在的行还没有换行
+	inLine bool
+}
+
+func NewTerminalProgress(f *os.File) *TerminalProgress {
+	interactive := false
+	if fi, err := f.Stat(); err == nil {
+		interactive = fi.Mode()&os.ModeCharDevice != 0
+	}
+	return &TerminalProgress{w: f, interactive: interactive, lastStep: map[string]int64{}}
+}
+
+// 不使用进度条,每完成10%输出一行,用于同时输出多个进度的场景
+func NewLineProgress(w io.Writer) *TerminalProgress {
+	return &TerminalProgress{w: w, lastStep: map[string]int64{}}
+}
+
+func (t *TerminalProgress) Report(p Progress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.interactive {
+		line := fmt.Sprintf("\r%s %s %s", p.Stage, p.Name, formatProgress(p))
+		if p.Done {
+			line += "\n"
+		}
+		fmt.Fprint(t.w, line)
+		t.inLine = !p.Done
+		return
+	}
+
+	key := p.Stage + " " + p.Name
+	step := int64(-1)
+	if percent := p.Percent(); percent >= 0 {
+		step = int64(percent / 10)
+	}
+	if p.Done {
+		last, ok := t.lastStep[key]
+		delete(t.lastStep, key)
+		if ok && last >= 10 {
+			return
+		}
+	} else if last, ok := t.lastStep[key]; (ok && last == step) || step < 0 {
+		return
+	} else {
+		t.lastStep[key] = step
+	}
+	fmt.Fprintln(t.w, p.Stage, p.Name, formatProgress(p))
+}
+
+func (t *TerminalProgress) Message(m ProgressMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.inLine {
+		fmt.Fprintln(t.w)
+		t.inLine = false
+	}
+	fmt.Fprintln(t.w, m.Text)
+}
+
+const _progressBarWidth = 30
+
+func formatProgress(p Progress) string {
+	var sb strings.Builder
+	percent := p.Percent()
+	if percent >= 0 {
+		filled := int(percent * _progressBarWidth / 100)
+		if filled > _progressBarWidth {
+			filled = _progressBarWidth
+		}
+		sb.WriteString("[" + strings.Repeat("=", filled) + strings.Repeat(" ", _progressBarWidth-filled) + "]")
+		sb.WriteString(fmt.Sprintf(" %5.1f%%", percent))
+	}
+
+	if p.Stage == ProgressDownload || p.Stage == ProgressUpload {
+		sb.WriteString(" " + FormatBytes(p.Current))
+		if p.Total >= 0 {
+			sb.WriteString("/" + FormatBytes(p.Total))
+		}
+		sb.WriteString(" " + FormatBytes(int64(p.Rate)) + "/s")
+	} else {
+		sb.WriteString(fmt.Sprintf(" %d", p.Current))
+		if p.Total >= 0 {
+			sb.WriteString(fmt.Sprintf("/%d", p.Total))
+		}
+		sb.WriteString(" files")
+	}
+
+	if !p.Done && p.ETA >= 0 {
+		sb.WriteString(" ETA " + p.ETA.Round(time.Second).String())
+	}
+	return sb.String()
+}
+
+// 将字节数格式化为1.5MB这样的字符串
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n), "B"
+	for _, each := range []string{"KB", "MB", "GB", "TB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, each
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
+
+// 统计进度并按时间间隔通知ProgressReporter,reporter为nil时不做任何事
+type ProgressTracker struct {
+	reporter  ProgressReporter
+	stage     string
+	name      string
+	total     int64
+	current   int64
+	base      int64
+	startTime time.Time
+	lastTime  time.Time
+}
+
+// 两次进度通知之间的最短间隔
+const _progressInterval = 200 * time.Millisecond
+
+func NewProgressTracker(reporter ProgressReporter, stage, name string, total int64) *ProgressTracker {
+	return &ProgressTracker{
+		reporter:  reporter,
+		stage:     stage,
+		name:      name,
+		total:     total,
+		startTime: time.Now(),
+	}
+}
+
+// 设置当前进度,用于断点续传时从已下载的位置开始统计,已有的部分不计入速度
+func (t *ProgressTracker) SetCurrent(current, total int64) {
+	t.current, t.total, t.base = current, total, current
+	t.startTime = time.Now()
+	t.report(false)
+}
+
+// 重试时回退到指定位置,不重新计算速度
+func (t *ProgressTracker) Rewind(current int64) {
+	t.current = current
+}
+
+func (t *ProgressTracker) Add(n int64) {
+	t.current += n
+	t.report(false)
+}
+
+// 实现io.Writer,用于统计写入的字节数
+func (t *ProgressTracker) Write(b []byte) (int, error) {
+	t.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func (t *ProgressTracker) Done() {
+	t.report(true)
+}
+
+// 通过ProgressReporter输出提示信息,t为nil时输出到标准输出
+func (t *ProgressTracker) Message(text string) {
+	if t == nil {
+		ReportMessage(nil, "", "", text)
+		return
+	}
+	ReportMessage(t.reporter, t.stage, t.name, text)
+}
+
+func (t *ProgressTracker) report(done bool) {
+	if t == nil || t.reporter == nil {
+		return
+	}
+	now := time.Now()
+	if !done && now.Sub(t.lastTime) < _progressInterval {
+		return
+	}
+	t.lastTime = now
+
+	p := Progress{
+		Stage:   t.stage,
+		Name:    t.name,
+		Current: t.current,
+		Total:   t.total,
+		ETA:     -1,
+		Done:    done,
+	}
+	if elapsed := now.Sub(t.startTime).Seconds(); elapsed > 0 {
+		p.Rate = float64(t.current-t.base) / elapsed
+	}
+	if done {
+		p.ETA = 0
+	} else if p.Rate > 0 && t.total >= t.current {
+		p.ETA = time.Duration(float64(t.total-t.current) / p.Rate * float64(time.Second))
+	}
+	t.reporter.Report(p)
+}
@@ -2,8 +2,9 @@ package pkg
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
 )
 
@@ -105,31 +106,12 @@ func (p *Push) Run() int {
 
 	PrintManifest(info)
 
-	req, err := http.NewRequest("PUT", p.Target, packageStream)
+	err = NewFeedClient(p.Target, p.Authentication).Upload(context.Background(), io.NewSectionReader(packageStream, 0, fi.Size()), fi.Size())
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	req.Header.Set("Content-Length", fmt.Sprintf("%d", fi.Size()))
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	if p.Authentication != nil {
-		req.SetBasicAuth(p.Authentication[0], p.Authentication[1])
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		fmt.Fprintln(os.Stderr, resp.Status)
-		return 1
-	}
-
 	fmt.Println(info.GroupAndName(), info.Version(), "published!")
 
 	return 0
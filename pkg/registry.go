@@ -2,20 +2,20 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 type Registry string
@@ -42,6 +42,9 @@ var (
 		return Registry(filepath.Join(wd, "plugins"))
 	}()
 	Unregistered = Registry("")
+
+	// 同一进程内并行安装时串行访问注册表,避免互相等待文件锁
+	_registryMutex sync.Mutex
 )
 
 func (r Registry) retry(task func() error) error {
@@ -74,6 +77,9 @@ func (r Registry) withLock(task func() error, description string) (err error) {
 		return errors.New("description must not contain line breaks")
 	}
 
+	_registryMutex.Lock()
+	defer _registryMutex.Unlock()
+
 	err = os.MkdirAll(string(r), 0777)
 	if err != nil {
 		return err
@@ -218,19 +224,8 @@ func (r Registry) RegisterPackage(group, name string, version *UniversalPackageV
 
 	return r.retry(func() error {
 		return r.withLock(func() error {
-			var packages []*InstalledPackage
-			f, err := os.Open(filepath.Join(string(r), "installedPackages.json"))
-			if err == nil {
-				err = json.NewDecoder(f).Decode(&packages)
-				if err != nil {
-					_ = f.Close()
-					return err
-				}
-				err = f.Close()
-				if err != nil {
-					return err
-				}
-			} else if !os.IsNotExist(err) {
+			packages, err := r.readInstalledPackages()
+			if err != nil {
 				return err
 			}
 
@@ -245,126 +240,244 @@ func (r Registry) RegisterPackage(group, name string, version *UniversalPackageV
 				*installedUsing = "plugininstaller/" + Version
 			}
 
-			packages = append(packages, &InstalledPackage{
-				Group:   group,
-				Name:    name,
-				Version: version,
-				Path:    &intendedPath,
-				// FeedURL:            &feedURL,
+			installedPackage := &InstalledPackage{
+				Group:              group,
+				Name:               name,
+				Version:            version,
+				Path:               &intendedPath,
 				InstallationDate:   &InstalledPackageDate{time.Now().Local(), ""},
 				InstallationReason: installationReason,
 				InstalledUsing:     installedUsing,
 				InstalledBy:        installedBy,
-			})
+			}
+			if feedURL != "" {
+				installedPackage.FeedURL = &feedURL
+			}
+			packages = append(packages, installedPackage)
 
-			f, err = os.Create(filepath.Join(string(r), "installedPackages.json"))
+			return r.writeInstalledPackages(packages)
+		}, "checking installation status of "+group+"/"+name+" "+version.String())
+	})
+}
+
+// 从注册表中移除指定的模块,同时删除保存的upack.json
+func (r Registry) UnregisterPackage(group, name string, version *UniversalPackageVersion) error {
+	if r == "" {
+		return nil
+	}
+
+	return r.retry(func() error {
+		return r.withLock(func() error {
+			packages, err := r.readInstalledPackages()
 			if err != nil {
 				return err
 			}
-			defer f.Close()
 
-			err = json.NewEncoder(f).Encode(&packages)
-			return err
-		}, "checking installation status of "+group+"/"+name+" "+version.String())
+			remaining := packages[:0]
+			for _, pkg := range packages {
+				if strings.EqualFold(pkg.Group, group) && strings.EqualFold(pkg.Name, name) && pkg.Version.Equals(version) {
+					continue
+				}
+				remaining = append(remaining, pkg)
+			}
+
+			err = os.Remove(r.getInstalledManifestPath(group, name, version))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return r.writeInstalledPackages(remaining)
+		}, "unregistering "+group+"/"+name+" "+version.String())
 	})
 }
 
-func (r Registry) cachePackageToDisk(w io.Writer, group, name string, version *UniversalPackageVersion, feedURL string, feedAuthentication *[2]string) error {
-	encodedName := url.PathEscape(name)
-	if group != "" {
-		encodedName = url.PathEscape(group) + "/" + encodedName
+func (r Registry) readInstalledPackages() ([]*InstalledPackage, error) {
+	var packages []*InstalledPackage
+	f, err := os.Open(filepath.Join(string(r), "installedPackages.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&packages)
+	if err != nil {
+		return nil, err
 	}
+	return packages, nil
+}
 
-	req, err := http.NewRequest("GET", strings.TrimRight(feedURL, "/")+"/download/"+encodedName+"/"+url.QueryEscape(version.String()), nil)
+func (r Registry) writeInstalledPackages(packages []*InstalledPackage) error {
+	f, err := os.Create(filepath.Join(string(r), "installedPackages.json"))
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(&packages)
+}
+
+func (r Registry) getInstalledManifestPath(group, name string, version *UniversalPackageVersion) string {
+	return filepath.Join(string(r), "manifests", strings.Replace(group, "/", "$", -1)+"$"+name, name+"."+version.String()+".json")
+}
 
-	if feedAuthentication != nil {
-		req.SetBasicAuth(feedAuthentication[0], feedAuthentication[1])
+// 保存已安装模块的upack.json,卸载时需要读取其中声明的hooks
+func (r Registry) SaveInstalledManifest(group, name string, version *UniversalPackageVersion, metadata *UniversalPackageMetadata) error {
+	if r == "" || metadata == nil {
+		return nil
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	manifestPath := r.getInstalledManifestPath(group, name, version)
+	err := os.MkdirAll(filepath.Dir(manifestPath), 0777)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(manifestPath)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer f.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("downloading package: %s", resp.Status)
+	return json.NewEncoder(f).Encode(metadata)
+}
+
+// 读取已安装模块保存的upack.json,不存在时返回nil
+func (r Registry) GetInstalledManifest(group, name string, version *UniversalPackageVersion) (*UniversalPackageMetadata, error) {
+	if r == "" {
+		return nil, nil
 	}
 
-	_, err = io.Copy(w, resp.Body)
-	return err
+	f, err := os.Open(r.getInstalledManifestPath(group, name, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadManifest(f)
+}
+
+func (r Registry) cachePackageToDisk(f *os.File, feed *FeedClient, group, name string, version *UniversalPackageVersion) error {
+	err := feed.DownloadToFile(context.Background(), f, group, name, version.String())
+	if err != nil {
+		return errors.Wrap(err, "downloading package")
+	}
+	return nil
 }
 
 func (r Registry) GetOrDownload(group, name string, version *UniversalPackageVersion, feedURL string, feedAuthentication *[2]string, cache bool) (*os.File, func() error, error) {
-	if r == "" || !cache {
-		f, err := os.CreateTemp("", "upack")
-		if err != nil {
-			return nil, nil, err
-		}
-		temp_file_name := f.Name()
+	return r.GetOrDownloadFromFeed(NewFeedClient(feedURL, feedAuthentication), group, name, version, cache)
+}
 
-		startTime := time.Now()
-		fmt.Println("downloading", fmt.Sprintf("%s/%s@%s", group, name, version.String()), "please waitting...")
-		err = r.cachePackageToDisk(f, group, name, version, feedURL, feedAuthentication)
+// 从缓存中读取模块包,缓存中不存在时从feed中下载;
+// 下载中断时已下载的内容保留在缓存目录的.partial文件中,下次继续下载,cache为false时使用后删除.
+// 没有插件目录时(如installapp、bundle export)下载到用户目录的缓存中,同样可以继续下载
+func (r Registry) GetOrDownloadFromFeed(feed *FeedClient, group, name string, version *UniversalPackageVersion, cache bool) (*os.File, func() error, error) {
+	if r == "" {
+		return User.GetOrDownloadFromFeed(feed, group, name, version, false)
+	}
+
+	cachePath := r.getCachedPackagePath(group, name, version)
+
+	if cache {
+		f, err := os.Open(cachePath)
 		if err == nil {
-			_, err = f.Seek(0, io.SeekStart)
+			return f, f.Close, nil
 		}
-		if err != nil {
-			_ = f.Close()
-			_ = os.Remove(temp_file_name)
+		if !os.IsNotExist(err) {
 			return nil, nil, err
 		}
-		timeDuration := time.Since(startTime)
-		fmt.Println("download finished", fmt.Sprintf("%s/%s@%s", group, name, version.String()), fmt.Sprintf("elapsed time:%.0f seconds", timeDuration.Seconds()))
-
-		return f, func() error {
-			err := f.Close()
-			if e := os.Remove(temp_file_name); err == nil {
-				err = e
-			}
-			return err
-		}, nil
 	}
 
-	cachePath := r.getCachedPackagePath(group, name, version)
-
-	f, err := os.Open(cachePath)
-	if err == nil {
-		return f, f.Close, nil
+	err := os.MkdirAll(filepath.Dir(cachePath), 0777)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if !os.IsNotExist(err) {
+	// 先下载到.partial文件,下载失败时保留已下载的内容,下次继续下载;
+	// 其它安装正在下载同一个模块包时下载到单独的临时文件,失败时删除
+	partialPath := cachePath + ".partial"
+	f, err := openPartialFile(partialPath)
+	if err == errPartialFileBusy {
+		f, err = os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	}
+	if err != nil {
 		return nil, nil, err
 	}
 
-	err = os.MkdirAll(filepath.Dir(cachePath), 0777)
+	if !cache {
+		err = r.downloadWithMessages(f, feed, group, name, version)
+	} else {
+		err = r.cachePackageToDisk(f, feed, group, name, version)
+	}
 	if err != nil {
+		_ = f.Close()
+		if f.Name() != partialPath {
+			_ = os.Remove(f.Name())
+		}
 		return nil, nil, err
 	}
+	if !cache {
+		return f, removeWhileOpen(f), nil
+	}
 
-	f, err = os.OpenFile(cachePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	err = f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), cachePath)
+	}
 	if err != nil {
+		_ = os.Remove(f.Name())
 		return nil, nil, err
 	}
 
-	err = r.cachePackageToDisk(f, group, name, version, feedURL, feedAuthentication)
+	f, err = os.Open(cachePath)
 	if err != nil {
-		_ = f.Close()
-		_ = os.Remove(cachePath)
 		return nil, nil, err
 	}
+	return f, f.Close, nil
+}
 
-	_, err = f.Seek(0, io.SeekStart)
+// 其它安装正在写入同一个.partial文件
+var errPartialFileBusy = errors.New("partial download is in use")
+
+// 下载模块包到f中并输出开始与完成的提示,完成后f定位到开头
+func (r Registry) downloadWithMessages(f *os.File, feed *FeedClient, group, name string, version *UniversalPackageVersion) error {
+	startTime := time.Now()
+	packageName := fmt.Sprintf("%s/%s@%s", group, name, version.String())
+	ReportMessage(feed.Progress, ProgressDownload, packageName, "downloading "+packageName+" please waitting...")
+	err := r.cachePackageToDisk(f, feed, group, name, version)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
 	if err != nil {
-		_ = f.Close()
-		_ = os.Remove(cachePath)
-		return nil, nil, err
+		return err
 	}
+	timeDuration := time.Since(startTime)
+	ReportMessage(feed.Progress, ProgressDownload, packageName, fmt.Sprintf("download finished %s elapsed time:%.0f seconds", packageName, timeDuration.Seconds()))
+	return nil
+}
 
-	return f, f.Close, nil
+// 先删除文件名再在使用后关闭,避免其它安装在关闭与删除之间打开同一个.partial文件;
+// 无法删除打开的文件时(Windows)关闭后删除
+func removeWhileOpen(f *os.File) func() error {
+	if os.Remove(f.Name()) == nil {
+		return f.Close
+	}
+	return removeOnClose(f)
+}
+
+// 关闭并删除下载的文件
+func removeOnClose(f *os.File) func() error {
+	return func() error {
+		err := f.Close()
+		if e := os.Remove(f.Name()); err == nil {
+			err = e
+		}
+		return err
+	}
 }
 
 type InstalledPackage struct {
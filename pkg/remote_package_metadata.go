@@ -4,5 +4,13 @@ type RemotePackageMetadata struct {
 	Group         string   `json:"group,omitempty"`
 	Name          string   `json:"name"`
 	LatestVersion string   `json:"latestVersion,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Icon          string   `json:"icon,omitempty"`
+	Downloads     int64    `json:"downloads,omitempty"`
 	Versions      []string `json:"versions"`
 }
+
+func (m RemotePackageMetadata) GroupAndName() string {
+	return groupAndName(m.Group, m.Name)
+}
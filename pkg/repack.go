@@ -130,20 +130,35 @@ func (r *Repack) Run() int {
 		return 2
 	}
 
-	info, err := GetPackageMetadata(r.SourcePath)
+	_, err := r.Repackage()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if _, ok := err.(invalidManifestError); ok {
+			return 2
+		}
 		return 1
 	}
+	return 0
+}
+
+// The merged metadata does not pass validation.
+type invalidManifestError struct {
+	error
+}
+
+// Repackage creates the new package and returns the absolute path of the created file.
+func (r *Repack) Repackage() (string, error) {
+	info, err := GetPackageMetadata(r.SourcePath)
+	if err != nil {
+		return "", err
+	}
 	infoToMerge, err := r.GetMetadataToMerge()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 	hash, err := GetSHA1(r.SourcePath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 
 	id := info.GroupAndName() + ":" + info.Version() + ":" + hash
@@ -168,16 +183,15 @@ func (r *Repack) Run() int {
 		if strings.TrimSpace(r.Manifest) == "" {
 			thing = "parameters:"
 		}
-		fmt.Fprintln(os.Stderr, "Invalid", thing, err)
-		return 2
+		return "", invalidManifestError{errors.Errorf("Invalid %s %v", thing, err)}
 	}
 
 	PrintManifest(info)
 
 	if !r.NoAudit {
 		var history []interface{}
-		if h, ok := (*info)["repackageHistory"]; ok {
-			history = h.([]interface{})
+		if h, ok := (*info)["repackageHistory"].([]interface{}); ok {
+			history = h
 		} else {
 			history = make([]interface{}, 0, 1)
 		}
@@ -204,50 +218,50 @@ func (r *Repack) Run() int {
 	relativePackageFileName := info.Name() + "-" + info.BareVersion() + ".upack"
 	targetFileName, err := filepath.Abs(filepath.Join(r.TargetDirectory, relativePackageFileName))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 
 	if !r.Overwrite {
 		_, err = os.Stat(targetFileName)
-		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "Target file '%s' exists and overwrite was set to false.", targetFileName)
-				return 1
-			}
-			fmt.Fprintln(os.Stderr, err)
-			return 1
+		if err == nil {
+			return "", errors.Errorf("Target file '%s' exists and overwrite was set to false.", targetFileName)
+		}
+		if !os.IsNotExist(err) {
+			return "", err
 		}
 	}
 
-	tmpFile, err := os.CreateTemp("", "upack")
+	// Create the temporary file next to the target so that it can be renamed into place.
+	err = os.MkdirAll(filepath.Dir(targetFileName), 0755)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(targetFileName), ".upack")
+	if err != nil {
+		return "", err
 	}
 	tmpPath := tmpFile.Name()
 	defer func() {
 		if tmpFile != nil {
 			_ = tmpFile.Close()
-			_ = os.Remove(tmpPath)
 		}
+		_ = os.Remove(tmpPath)
 	}()
 
 	existingPackage, err := zip.OpenReader(r.SourcePath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
+	defer existingPackage.Close()
+
 	builder := zip.NewWriter(tmpFile)
 	w, err := builder.Create("upack.json")
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 	err = json.NewEncoder(w).Encode(info)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 
 	for _, entry := range existingPackage.File {
@@ -255,61 +269,55 @@ func (r *Repack) Run() int {
 			continue
 		}
 
-		w, err = builder.CreateHeader(&entry.FileHeader)
+		header := entry.FileHeader
+		w, err = builder.CreateHeader(&header)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return 1
+			return "", err
 		}
 
 		if !entry.Mode().IsDir() {
-			stream, err := entry.Open()
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return 1
-			}
-
-			_, err = io.Copy(w, stream)
+			err = copyZipEntry(w, entry)
 			if err != nil {
-				_ = stream.Close()
-				fmt.Fprintln(os.Stderr, err)
-				return 1
-			}
-
-			err = stream.Close()
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				return 1
+				return "", err
 			}
 		}
 	}
 
-	err = os.MkdirAll(filepath.Dir(targetFileName), 0755)
+	err = builder.Close()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	err = os.Remove(targetFileName)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 	err = tmpFile.Close()
 	tmpFile = nil
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
-	err = os.Rename(targetFileName, tmpPath)
+	err = os.Remove(targetFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	err = os.Rename(tmpPath, targetFileName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+		return "", err
 	}
 
-	return 0
+	return targetFileName, nil
+}
+
+func copyZipEntry(w io.Writer, entry *zip.File) error {
+	stream, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, stream)
+	if e := stream.Close(); err == nil {
+		err = e
+	}
+	return err
 }
 
 func (r *Repack) GetMetadataToMerge() (metadata *UniversalPackageMetadata, err error) {
-	if strings.TrimSpace(r.Manifest) != "" {
+	if strings.TrimSpace(r.Manifest) == "" {
 		return &r.Metadata, nil
 	}
 	metadataStream, err := os.Open(r.Manifest)
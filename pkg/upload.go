@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 分块上传时每块的默认大小
+const DefaultUploadChunkSize = 8 << 20
+
+func (c *FeedClient) retryPolicy() RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return DefaultRetryPolicy
+}
+
+// 执行f,遇到网络错误或5xx响应时按照重试策略重试,重试的提示通过progress输出
+func (c *FeedClient) withRetry(ctx context.Context, operation string, progress *ProgressTracker, f func() error) error {
+	policy := c.retryPolicy()
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			wait := policy.backoff(attempt)
+			progress.Message(fmt.Sprintf("%s failed: %v, retrying in %.1f seconds (%d/%d)...", operation, err, wait.Seconds(), attempt, policy.MaxRetries))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		err = f()
+		if err == nil || !isTransientError(err) || attempt >= policy.MaxRetries {
+			return err
+		}
+	}
+}
+
+// 上传模块包,name用于输出进度;失败时按照重试策略重试,
+// 超过UploadChunkThreshold的模块包分块上传,每块单独重试
+func (c *FeedClient) UploadFile(ctx context.Context, r io.ReaderAt, size int64, name string) error {
+	progress := NewProgressTracker(c.Progress, ProgressUpload, name, size)
+	var err error
+	if c.UploadChunkThreshold > 0 && size > c.UploadChunkThreshold {
+		err = c.uploadChunks(ctx, r, size, progress)
+	} else {
+		err = c.withRetry(ctx, "upload", progress, func() error {
+			progress.Rewind(0)
+			return c.uploadBody(ctx, http.MethodPut, c.endpoint("", nil), io.NewSectionReader(r, 0, size), size, progress, http.StatusCreated)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	progress.Done()
+	return nil
+}
+
+func (c *FeedClient) uploadBody(ctx context.Context, method, addr string, body io.Reader, size int64, progress *ProgressTracker, expected ...int) error {
+	if progress != nil && body != nil {
+		body = io.TeeReader(body, progress)
+	}
+	req, err := c.newRequest(ctx, method, addr, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req, expected...)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// 分块上传:每块通过upload?id=&index=&offset=&totalSize=&partSize=&totalParts=上传,
+// 全部上传后通过upload?id=&multipart=complete完成
+func (c *FeedClient) uploadChunks(ctx context.Context, r io.ReaderAt, size int64, progress *ProgressTracker) error {
+	chunkSize := c.UploadChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	totalParts := (size + chunkSize - 1) / chunkSize
+	id := uuid.NewString()
+
+	for index := int64(0); index < totalParts; index++ {
+		offset := index * chunkSize
+		partSize := chunkSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+		query := url.Values{
+			"id":         {id},
+			"index":      {strconv.FormatInt(index, 10)},
+			"offset":     {strconv.FormatInt(offset, 10)},
+			"totalSize":  {strconv.FormatInt(size, 10)},
+			"partSize":   {strconv.FormatInt(chunkSize, 10)},
+			"totalParts": {strconv.FormatInt(totalParts, 10)},
+		}
+		err := c.withRetry(ctx, fmt.Sprintf("upload part %d/%d", index+1, totalParts), progress, func() error {
+			progress.Rewind(offset)
+			return c.uploadBody(ctx, http.MethodPost, c.endpoint("upload", query), io.NewSectionReader(r, offset, partSize), partSize, progress)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.withRetry(ctx, "complete upload", progress, func() error {
+		return c.uploadBody(ctx, http.MethodPost, c.endpoint("upload", url.Values{"id": {id}, "multipart": {"complete"}}), nil, 0, nil)
+	})
+}
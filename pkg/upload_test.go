@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 本地目录feed作为服务端,intercept返回true时请求不再交给feed处理
+type testUploadServer struct {
+	feed      *DirectoryFeed
+	intercept func(w http.ResponseWriter, r *http.Request, attempt int) bool
+
+	mu    sync.Mutex
+	parts []string
+}
+
+func newTestUploadServer(t *testing.T) (*testUploadServer, *FeedClient) {
+	t.Helper()
+	s := &testUploadServer{feed: NewDirectoryFeed(t.TempDir())}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client := NewFeedClient(srv.URL+"/", nil)
+	client.Retry = &RetryPolicy{MaxRetries: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	client.Progress = QuietProgress{}
+	client.UploadChunkThreshold = 100
+	client.UploadChunkSize = 64
+	return s, client
+}
+
+func (s *testUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if r.URL.Path == "/upload" && query.Get("multipart") == "" {
+		s.mu.Lock()
+		attempt := 0
+		for _, index := range s.parts {
+			if index == query.Get("index") {
+				attempt++
+			}
+		}
+		s.parts = append(s.parts, query.Get("index"))
+		s.mu.Unlock()
+		if s.intercept != nil && s.intercept(w, r, attempt) {
+			return
+		}
+	}
+	s.feed.ServeHTTP(w, r)
+}
+
+func testUploadPackage(t *testing.T) []byte {
+	t.Helper()
+	data := testPackage(t, map[string]interface{}{"group": "g", "name": "n", "version": "1.0.0", "description": hex.EncodeToString(testContent(200))})
+	if len(data) <= 3*64 {
+		t.Fatalf("test package is too small for a chunked upload: %d bytes", len(data))
+	}
+	return data
+}
+
+func TestUploadFileChunkedRoundTrip(t *testing.T) {
+	s, client := newTestUploadServer(t)
+	//第二块第一次上传时返回503,只重试该块
+	s.intercept = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		if r.URL.Query().Get("index") == "1" && attempt == 0 {
+			_, _ = io.Copy(io.Discard, r.Body)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	data := testUploadPackage(t)
+
+	err := client.UploadFile(context.Background(), bytes.NewReader(data), int64(len(data)), "g/n@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totalParts := (len(data) + 63) / 64
+	var retried int
+	for _, index := range s.parts {
+		if index == "1" {
+			retried++
+		}
+	}
+	if len(s.parts) != totalParts+1 || retried != 2 {
+		t.Fatalf("uploaded parts %v, want %d parts with part 1 retried once", s.parts, totalParts)
+	}
+
+	version, err := client.GetVersion(context.Background(), "g", "n", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(data)
+	if version.SHA1 != hex.EncodeToString(sum[:]) || version.Size != int64(len(data)) {
+		t.Fatalf("stored package sha1 %s size %d, want %s size %d", version.SHA1, version.Size, hex.EncodeToString(sum[:]), len(data))
+	}
+}
+
+func TestUploadFileChunkedSizeMismatch(t *testing.T) {
+	s, client := newTestUploadServer(t)
+	//最后一块只写入一部分,完成上传时长度与totalSize不一致
+	s.intercept = func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		index, _ := strconv.Atoi(r.URL.Query().Get("index"))
+		totalParts, _ := strconv.Atoi(r.URL.Query().Get("totalParts"))
+		if index == totalParts-1 {
+			r.Body = io.NopCloser(io.LimitReader(r.Body, 10))
+		}
+		return false
+	}
+	data := testUploadPackage(t)
+
+	err := client.UploadFile(context.Background(), bytes.NewReader(data), int64(len(data)), "g/n@1.0.0")
+	if err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	if _, err = client.GetVersion(context.Background(), "g", "n", "1.0.0"); !IsNotFound(err) {
+		t.Fatalf("incomplete upload was published: %v", err)
+	}
+	parts, _ := filepath.Glob(filepath.Join(s.feed.Root, "*.part"))
+	if len(parts) > 0 {
+		t.Fatalf("multipart upload files were left behind: %v", parts)
+	}
+}
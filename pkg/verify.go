@@ -1,12 +1,9 @@
 package pkg
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
-	"strings"
 )
 
 type Verify struct {
@@ -62,42 +59,16 @@ func (v *Verify) Run() int {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
-	req, err := http.NewRequest("GET", strings.TrimRight(v.SourceEndpoint, "/")+"/versions?"+(url.Values{"group": {metadata.Group()}, "name": {metadata.Name()}, "version": {metadata.Version()}}).Encode(), nil)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-
-	if v.Authentication != nil {
-		req.SetBasicAuth(v.Authentication[0], v.Authentication[1])
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		fmt.Fprintln(os.Stderr, "ProGet returned HTTP error:", resp.Status)
+	remoteVersion, err := NewFeedClient(v.SourceEndpoint, v.Authentication).GetVersion(context.Background(), metadata.Group(), metadata.Name(), metadata.Version())
+	if IsNotFound(err) {
+		fmt.Fprintln(os.Stderr, "Package", metadata.GroupAndName(), "was not found in feed.")
 		return 1
 	}
-
-	var remoteVersion struct {
-		SHA1 string `json:"sha1"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&remoteVersion)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	if remoteVersion.SHA1 == "" {
-		fmt.Fprintln(os.Stderr, "Package", metadata.GroupAndName(), "was not found in feed.")
-		return 1
-	}
-
 	sha1, err := GetSHA1(v.PackagePath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,240 @@
+package pkg
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var partialVersionRegex = regexp.MustCompile(`\A([0-9]+|[xX*])(?:\.([0-9]+|[xX*]))?(?:\.([0-9]+|[xX*]))?(?:-([0-9a-zA-Z\.-]+))?(?:\+([0-9a-zA-Z\.-]+))?\z`)
+
+// 版本约束,如">=3.2 <4"、"^1.2"、"~2.0.1"、"2.*"、"1.0.0 || >=2.1"
+// 空格或逗号分隔的条件需要同时满足,"||"分隔的条件满足其一即可
+type VersionConstraint struct {
+	raw          string
+	alternatives [][]versionComparator
+}
+
+type versionComparator struct {
+	op      string
+	version *UniversalPackageVersion
+}
+
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	c := &VersionConstraint{raw: strings.TrimSpace(s)}
+	for _, alternative := range strings.Split(c.raw, "||") {
+		var comparators []versionComparator
+		fields := strings.FieldsFunc(alternative, func(r rune) bool {
+			return r == ' ' || r == ',' || r == '\t'
+		})
+		for index := 0; index < len(fields); index++ {
+			field := fields[index]
+			// 允许运算符与版本号之间存在空格,如">= 3.2"
+			if isComparatorOperator(field) && index+1 < len(fields) {
+				index++
+				field += fields[index]
+			}
+			parsed, err := parseComparator(field)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid version constraint '%s'", s)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+	return c, nil
+}
+
+// 版本号本身是否为精确的版本号,而不是一个范围
+func IsExactVersion(s string) bool {
+	_, err := ParseUniversalPackageVersion(strings.TrimPrefix(strings.TrimSpace(s), "="))
+	return err == nil
+}
+
+func (c *VersionConstraint) String() string {
+	return c.raw
+}
+
+// 判断版本是否满足约束
+func (c *VersionConstraint) Check(v *UniversalPackageVersion) bool {
+	if c == nil || v == nil {
+		return c == nil
+	}
+	for _, comparators := range c.alternatives {
+		matched := true
+		for _, comparator := range comparators {
+			if !comparator.check(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// 在版本列表中查找满足约束的最高版本,prerelease为false时忽略预发布版本
+func (c *VersionConstraint) Latest(versions []*UniversalPackageVersion, prerelease bool) *UniversalPackageVersion {
+	var latest *UniversalPackageVersion
+	for _, v := range versions {
+		if !prerelease && v.Prerelease != "" {
+			continue
+		}
+		if !c.Check(v) {
+			continue
+		}
+		if latest == nil || latest.Compare(v) < 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+func (cmp versionComparator) check(v *UniversalPackageVersion) bool {
+	diff := v.Compare(cmp.version)
+	switch cmp.op {
+	case ">":
+		return diff > 0
+	case ">=":
+		return diff >= 0
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	case "!=":
+		return diff != 0
+	}
+	return diff == 0
+}
+
+func isComparatorOperator(s string) bool {
+	switch s {
+	case ">", ">=", "<", "<=", "=", "==", "!=", "^", "~":
+		return true
+	}
+	return false
+}
+
+func parseComparator(s string) ([]versionComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "==", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			s = strings.TrimSpace(s[len(prefix):])
+			break
+		}
+	}
+	if op == "==" {
+		op = "="
+	}
+
+	match := partialVersionRegex.FindStringSubmatch(s)
+	if match == nil {
+		return nil, errors.Errorf("'%s' is not a valid version", s)
+	}
+
+	// 记录实际指定了几段版本号,通配符视为未指定
+	var parts []*big.Int
+	for _, part := range match[1:4] {
+		if part == "" || part == "*" || part == "x" || part == "X" {
+			break
+		}
+		n, _ := new(big.Int).SetString(part, 10)
+		parts = append(parts, n)
+	}
+	prerelease, build := match[4], match[5]
+	if len(parts) < 3 && (prerelease != "" || build != "") {
+		return nil, errors.Errorf("'%s' is not a valid version", s)
+	}
+
+	lower := versionFromParts(parts, prerelease, build)
+	if len(parts) == 0 {
+		switch op {
+		case "", "=", "^", "~", ">=", "<=":
+			return nil, nil
+		}
+		return nil, errors.Errorf("'%s%s' never matches", op, s)
+	}
+
+	// 部分版本号如3.2表示3.2.*,其上界为3.3.0
+	upper := upperBound(parts, len(parts)-1)
+	switch op {
+	case "", "=":
+		if len(parts) == 3 {
+			return []versionComparator{{"=", lower}}, nil
+		}
+		return []versionComparator{{">=", lower}, {"<", upper}}, nil
+	case "!=":
+		return []versionComparator{{"!=", lower}}, nil
+	case ">=", "<":
+		return []versionComparator{{op, lower}}, nil
+	case ">":
+		if len(parts) == 3 {
+			return []versionComparator{{">", lower}}, nil
+		}
+		return []versionComparator{{">=", upper}}, nil
+	case "<=":
+		if len(parts) == 3 {
+			return []versionComparator{{"<=", lower}}, nil
+		}
+		return []versionComparator{{"<", upper}}, nil
+	case "~":
+		// ~1.2.3 := >=1.2.3 <1.3.0, ~1 := >=1.0.0 <2.0.0
+		index := 1
+		if len(parts) == 1 {
+			index = 0
+		}
+		return []versionComparator{{">=", lower}, {"<", upperBound(parts, index)}}, nil
+	case "^":
+		// ^1.2.3 := >=1.2.3 <2.0.0, ^0.2.3 := >=0.2.3 <0.3.0
+		index := 0
+		for index < len(parts)-1 && parts[index].Sign() == 0 {
+			index++
+		}
+		return []versionComparator{{">=", lower}, {"<", upperBound(parts, index)}}, nil
+	}
+	return nil, errors.Errorf("unknown operator '%s'", op)
+}
+
+func versionFromParts(parts []*big.Int, prerelease, build string) *UniversalPackageVersion {
+	var values [3]big.Int
+	for index, part := range parts {
+		values[index].Set(part)
+	}
+	return NewUniversalPackageVersion(&values[0], &values[1], &values[2], prerelease, build)
+}
+
+// 保留index之前的段,将第index段加1,其余段置0;
+// 上界为最低的预发布版本X.Y.Z-0,使^1.2、~1.2等范围不包含上界的预发布版本如2.0.0-alpha
+func upperBound(parts []*big.Int, index int) *UniversalPackageVersion {
+	var values [3]big.Int
+	for i := 0; i < index; i++ {
+		values[i].Set(parts[i])
+	}
+	values[index].Add(parts[index], big.NewInt(1))
+	return NewUniversalPackageVersion(&values[0], &values[1], &values[2], "0", "")
+}
+
+// 解析可能只包含部分段的版本号,如"3.2"解析为3.2.0
+func ParsePartialVersion(s string) (*UniversalPackageVersion, error) {
+	match := partialVersionRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return nil, errors.Errorf("'%s' is not a valid version", s)
+	}
+	var parts []*big.Int
+	for _, part := range match[1:4] {
+		if part == "" {
+			break
+		}
+		n, ok := new(big.Int).SetString(part, 10)
+		if !ok {
+			return nil, errors.Errorf("'%s' is not a valid version", s)
+		}
+		parts = append(parts, n)
+	}
+	return versionFromParts(parts, match[4], match[5]), nil
+}
@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionConstraintCheck(t *testing.T) {
+	for _, test := range []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		// 范围
+		{">=3.2 <4", []string{"3.2.0", "3.9.9"}, []string{"3.1.9", "4.0.0"}},
+		{">= 3.2, < 4", []string{"3.2.0", "3.9.9"}, []string{"3.1.9", "4.0.0"}},
+		{">3.2", []string{"3.3.0"}, []string{"3.2.5"}},
+		{">3.2.1", []string{"3.2.2"}, []string{"3.2.1"}},
+		{"<=3.2", []string{"3.2.9"}, []string{"3.3.0", "3.3.0-rc"}},
+		{"<=3.2.1", []string{"3.2.1"}, []string{"3.2.2"}},
+		{"!=1.0.0", []string{"1.0.1"}, []string{"1.0.0"}},
+		{"1.0.0 || >=2.1", []string{"1.0.0", "2.1.0"}, []string{"1.5.0", "2.0.0"}},
+		// 精确版本与部分版本
+		{"1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{"==1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{"1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9"}},
+		// 通配符
+		{"", []string{"0.0.1", "9.9.9"}, nil},
+		{"*", []string{"0.0.1", "9.9.9"}, nil},
+		{"2.*", []string{"2.0.0", "2.9.0"}, []string{"1.9.9", "3.0.0", "3.0.0-alpha"}},
+		{"2.x.x", []string{"2.0.0", "2.9.0"}, []string{"3.0.0"}},
+		{"2.1.X", []string{"2.1.0", "2.1.9"}, []string{"2.2.0"}},
+		// ~与^
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.3.0-beta"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"^ 1.2", []string{"1.2.0", "1.9.0"}, []string{"2.0.0"}},
+		// 预发布版本低于同一版本的正式版本
+		{">=1.0.0-beta", []string{"1.0.0-beta", "1.0.0-rc", "1.0.0"}, []string{"1.0.0-alpha"}},
+		{"<1.0.0", []string{"1.0.0-rc", "0.9.0"}, []string{"1.0.0"}},
+		{"^1.0.0-beta", []string{"1.0.0-beta", "1.5.0"}, []string{"2.0.0-alpha", "0.9.0"}},
+		{"=1.0.0-beta", []string{"1.0.0-beta"}, []string{"1.0.0"}},
+	} {
+		constraint, err := ParseVersionConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("%q: %v", test.constraint, err)
+			continue
+		}
+		for _, version := range test.matches {
+			if !constraint.Check(mustParseVersion(t, version)) {
+				t.Errorf("%q should match %s", test.constraint, version)
+			}
+		}
+		for _, version := range test.rejects {
+			if constraint.Check(mustParseVersion(t, version)) {
+				t.Errorf("%q should not match %s", test.constraint, version)
+			}
+		}
+	}
+}
+
+func TestParseVersionConstraintInvalid(t *testing.T) {
+	for _, constraint := range []string{"abc", ">=", "1.2-beta", ">*", "<x", "1.2.3.4", "~>1.0"} {
+		if _, err := ParseVersionConstraint(constraint); err == nil {
+			t.Errorf("%q: expected an error", constraint)
+		}
+	}
+}
+
+func TestVersionConstraintLatest(t *testing.T) {
+	var versions []*UniversalPackageVersion
+	for _, version := range []string{"1.0.0", "1.2.0", "2.0.0-beta", "1.5.0-rc", "1.4.0"} {
+		versions = append(versions, mustParseVersion(t, version))
+	}
+	for _, test := range []struct {
+		constraint string
+		prerelease bool
+		latest     string
+	}{
+		{"", false, "1.4.0"},
+		{"", true, "2.0.0-beta"},
+		{"^1.0", false, "1.4.0"},
+		{"^1.0", true, "1.5.0-rc"},
+		{"~1.2", false, "1.2.0"},
+		{">=3", true, ""},
+	} {
+		constraint, err := ParseVersionConstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := constraint.Latest(versions, test.prerelease)
+		if test.latest == "" {
+			if latest != nil {
+				t.Errorf("%q (prerelease %v): latest = %s, want none", test.constraint, test.prerelease, latest)
+			}
+			continue
+		}
+		if latest == nil || latest.String() != test.latest {
+			t.Errorf("%q (prerelease %v): latest = %v, want %s", test.constraint, test.prerelease, latest, test.latest)
+		}
+	}
+}
+
+func TestIsExactVersion(t *testing.T) {
+	for _, test := range []struct {
+		version string
+		exact   bool
+	}{
+		{"1.2.3", true},
+		{"=1.2.3", true},
+		{" 1.2.3-beta ", true},
+		{"1.2", false},
+		{"^1.2.3", false},
+		{"1.*", false},
+		{"latest", false},
+		{"", false},
+	} {
+		if exact := IsExactVersion(test.version); exact != test.exact {
+			t.Errorf("IsExactVersion(%q) = %v, want %v", test.version, exact, test.exact)
+		}
+	}
+}
+
+func mustParseVersion(t *testing.T, s string) *UniversalPackageVersion {
+	t.Helper()
+	version, err := ParseUniversalPackageVersion(strings.TrimSpace(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
@@ -13,6 +13,17 @@ func main() {
 		&cmd.PackApp{},
 		&cmd.Push{},
 		&cmd.List{},
+		&cmd.Uninstall{},
+		&cmd.Search{},
+		&cmd.Info{},
+		&cmd.Delete{},
+		&cmd.PruneFeed{},
+		&cmd.Promote{},
+		&cmd.Serve{},
+		&cmd.Mirror{},
+		&cmd.Bundle{},
+		&cmd.Login{},
+		&cmd.Logout{},
 	)
 	cmd.DefaultDispatcher.Run(os.Args[1:])
 }